@@ -0,0 +1,1421 @@
+// Package bitedit runs bit-editor's edit command language over a byte slice. A
+// program such as "s16t8[n]8" is a string of commands, each taking, skipping or
+// transforming the next bits of the input, and it repeats until the end of the
+// range. The command language is described in the README and in bit-editor -help.
+package bitedit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/PaulW-NZ/Bit-tools/bitio"
+	"github.com/PaulW-NZ/Bit-tools/crc"
+)
+
+var commandNames = map[rune]string{
+	't': "Take",
+	's': "Skip",
+	'i': "Insert",
+	'n': "Invert",
+	'v': "Reverse Bits",
+	'V': "Reverse Rest of Range",
+	'z': "Zero",
+	'Z': "Set to One",
+	'p': "Pad to Byte",
+	'P': "Pad to Multiple",
+	'b': "Byte-Swap",
+	'x': "XOR",
+	'a': "AND",
+	'o': "OR",
+	'I': "Masked Invert",
+	'X': "XNOR",
+	'A': "NAND",
+	'O': "NOR",
+	'D': "Differential Encode",
+	'F': "Differential Decode",
+	'l': "Length-Prefixed Take",
+	'r': "Rotate Right",
+	'd': "Replicate",
+	'G': "Binary to Gray",
+	'B': "Gray to Binary",
+	'L': "Shift Left",
+	'R': "Shift Right",
+	'g': "Flip Sign",
+	'*': "Tee Marker",
+}
+
+// Options controls how Apply runs a program. The zero value edits the whole input
+// with no logging and none of the optional passes.
+type Options struct {
+	StartBit      int                         // first input bit of the edited range
+	EndBit        int                         // end of the edited range (exclusive); 0 means the end of the input
+	Verbose       io.Writer                   // receives a log of every command when set
+	VerboseOnce   bool                        // only log the first pass of the command string
+	StrictBounds  bool                        // error instead of clamping when a length-prefixed take overruns
+	Splice        bool                        // copy bits outside [start, end) through unchanged
+	FrameSync     []byte                      // sync word (as bits) inserted before every frame of output
+	FrameInterval int                         // payload bits per frame when FrameSync is set
+	ReorderWords  int                         // words per block for bit-reversed reordering (0 disables it)
+	ReorderWidth  int                         // width in bits of each reordered word
+	XorDelay      int                         // delay D for the self-XOR pass (0 disables it)
+	XorInverse    bool                        // undo the self-XOR pass instead of applying it
+	Segments      *[][]byte                   // when set, receives the output of each block or pass separately
+	SampleWidth   int                         // PCM sample width in bits for the 'g' command; 0 means 16
+	SampleSigned  bool                        // samples are two's complement rather than offset binary
+	SampleLittle  bool                        // samples are stored least significant byte first
+	BitCount      *int                        // when set, receives the exact number of output bits
+	VerifyCRC     int                         // width of a trailing CRC to check and strip (0 disables it)
+	Tee           func(snapshot []byte) error // called with the output so far at each '*' marker (nil ignores markers)
+	ReverseRange  bool                        // reverse the order of the edited output bits
+	Repeat        int                         // maximum passes of the command string (0 repeats to the end of the range)
+	TailCopy      bool                        // copy the input left over after the last pass through unchanged
+}
+
+// flipSign negates each whole width-bit sample in bits and passes a trailing partial
+// sample through unchanged. Signed samples are two's complement and offset-binary
+// (unsigned) samples are negated about their midpoint. The one value with no
+// positive counterpart saturates to the largest sample instead of wrapping.
+func flipSign(bits []byte, width int, signed, littleEndian bool) []byte {
+	out := make([]byte, len(bits))
+	copy(out, bits)
+	mask := uint64(1)<<uint(width) - 1
+	for start := 0; start+width <= len(out); start += width {
+		sample := out[start : start+width]
+		if littleEndian {
+			reverseBytes(sample)
+		}
+		var value uint64
+		for _, bit := range sample {
+			value = value<<1 | uint64(bit)
+		}
+
+		// Negation is 2^W - v in both formats; only the overflow case differs.
+		negated := (mask + 1 - value) & mask
+		if signed && value == 1<<uint(width-1) {
+			negated = value - 1
+		} else if !signed && value == 0 {
+			negated = mask
+		}
+
+		for i := width - 1; i >= 0; i-- {
+			sample[i] = byte(negated & 1)
+			negated >>= 1
+		}
+		if littleEndian {
+			reverseBytes(sample)
+		}
+	}
+	return out
+}
+
+// rotateBits returns word rotated left (or right) by amount bits. The amount is taken
+// modulo the word's length, so a short final word rotates within what is there.
+func rotateBits(word []byte, amount int, left bool) []byte {
+	rotated := make([]byte, len(word))
+	if len(word) == 0 {
+		return rotated
+	}
+	amount %= len(word)
+	if !left {
+		amount = (len(word) - amount) % len(word)
+	}
+	copy(rotated, word[amount:])
+	copy(rotated[len(word)-amount:], word[:amount])
+	return rotated
+}
+
+// grayCode converts a word (most significant bit first) from binary to Gray code,
+// or from Gray code back to binary when decode is set.
+func grayCode(word []byte, decode bool) []byte {
+	converted := make([]byte, len(word))
+	for i, bit := range word {
+		switch {
+		case i == 0:
+			converted[i] = bit
+		case decode:
+			converted[i] = converted[i-1] ^ bit
+		default:
+			converted[i] = word[i-1] ^ bit
+		}
+	}
+	return converted
+}
+
+// wordOpKind names a rotate, shift or replicate command for error messages.
+func wordOpKind(command rune) string {
+	switch command {
+	case 'L', 'R':
+		return "shift"
+	case 'd':
+		return "replicate"
+	}
+	return "rotate"
+}
+
+// shiftBits returns word shifted left (or right) by amount bits with zero fill. The
+// result keeps the word's length, so shifting by the length or more gives all zeros.
+func shiftBits(word []byte, amount int, left bool) []byte {
+	shifted := make([]byte, len(word))
+	if amount >= len(word) {
+		return shifted
+	}
+	if left {
+		copy(shifted, word[amount:])
+	} else {
+		copy(shifted[amount:], word)
+	}
+	return shifted
+}
+
+// reverseBytes reverses the order of the 8-bit groups in bits, in place.
+func reverseBytes(bits []byte) {
+	for i, j := 0, len(bits)/8-1; i < j; i, j = i+1, j-1 {
+		for k := 0; k < 8; k++ {
+			bits[i*8+k], bits[j*8+k] = bits[j*8+k], bits[i*8+k]
+		}
+	}
+}
+
+// ToASCII expands each byte into 8 ASCII '0'/'1' characters, most significant bit first.
+func ToASCII(data []byte) []byte {
+	text := bitio.BytesToBits(data)
+	for i := range text {
+		text[i] += '0'
+	}
+	return text
+}
+
+// selfXor XORs each bit in place with the bit delay positions earlier, treating bits
+// before the slice as zero. Working forwards, the earlier bit is still the original
+// when applying, or already reconstructed when inverting, so the same loop does both.
+func selfXor(bits []byte, delay int, inverse bool) {
+	if inverse {
+		for i := delay; i < len(bits); i++ {
+			bits[i] ^= bits[i-delay]
+		}
+		return
+	}
+	for i := len(bits) - 1; i >= delay; i-- {
+		bits[i] ^= bits[i-delay]
+	}
+}
+
+// bitReverseReorder permutes bits in place, in blocks of numWords words of width bits,
+// so that word i moves to the position given by reversing the bits of i (the FFT
+// bit-reversal order). numWords must be a power of two. A final partial block is left
+// unchanged. The reordering is its own inverse.
+func bitReverseReorder(bits []byte, numWords, width int) {
+	addressBits := 0
+	for 1<<uint(addressBits) < numWords {
+		addressBits++
+	}
+	blockSize := numWords * width
+	block := make([]byte, blockSize)
+	for start := 0; start+blockSize <= len(bits); start += blockSize {
+		copy(block, bits[start:start+blockSize])
+		for i := 0; i < numWords; i++ {
+			j := 0
+			for b := 0; b < addressBits; b++ {
+				if i&(1<<uint(b)) != 0 {
+					j |= 1 << uint(addressBits-1-b)
+				}
+			}
+			copy(bits[start+j*width:start+(j+1)*width], block[i*width:(i+1)*width])
+		}
+	}
+}
+
+// insertFrameSync places the sync word before every interval bits of the payload,
+// including a final partial frame. The interval counts payload bits only.
+func insertFrameSync(bits, sync []byte, interval int) []byte {
+	framed := new(bytes.Buffer)
+	for i := 0; i < len(bits); i += interval {
+		end := i + interval
+		if end > len(bits) {
+			end = len(bits)
+		}
+		framed.Write(sync)
+		framed.Write(bits[i:end])
+	}
+	return framed.Bytes()
+}
+
+// crcStandards are the CRCs of each width crcBits supports, the crc tool's
+// CRC-8/DARC, CRC-16/MODBUS and CRC-32.
+var crcStandards = map[int]crc.Params{
+	8:  {Width: 8, Poly: 0x39, RefIn: true, RefOut: true},
+	16: {Width: 16, Poly: 0x8005, Init: 0xFFFF, RefIn: true, RefOut: true},
+	32: {Width: 32, Poly: 0x04C11DB7, Init: 0xFFFFFFFF, RefIn: true, RefOut: true, XorOut: 0xFFFFFFFF},
+}
+
+// crcBits computes the CRC of a slice of bits, zero-padded to a whole number of
+// bytes, and returns it as width bits, most significant bit first.
+func crcBits(bits []byte, width int) []byte {
+	sum := crc.Checksum(bitio.BitsToBytes(bits), crcStandards[width])
+	result := make([]byte, width)
+	for i := 0; i < width; i++ {
+		result[i] = byte(sum>>uint(width-1-i)) & 1
+	}
+	return result
+}
+
+// patternArgEnd returns the end of a "<N>:0x<hex>" or "<N>:@<path>" logical op argument
+// starting at start (or ":0x<hex>" / ":@<path>" in a block chain), or -1 for a binary pattern.
+// Hex digits such as 'a' and 'b' are also command letters, so both forms run to the next
+// ';', which is included, or to the end of the commands. A binary "0" followed by an 'x'
+// command, as in "a8:0x8:1" or "[a:0x:1]", is left to the binary parser.
+func patternArgEnd(commands string, start int) int {
+	i := start
+	for i < len(commands) && commands[i] >= '0' && commands[i] <= '9' {
+		i++
+	}
+	switch {
+	case strings.HasPrefix(commands[i:], ":@"):
+	case strings.HasPrefix(commands[i:], ":0x"):
+		j := i + len(":0x")
+		for j < len(commands) && commands[j] >= '0' && commands[j] <= '9' {
+			j++
+		}
+		if j < len(commands) && commands[j] == ':' {
+			return -1
+		}
+	default:
+		return -1
+	}
+	if end := strings.IndexByte(commands[i:], ';'); end != -1 {
+		return i + end + 1
+	}
+	return len(commands)
+}
+
+// patternFiles caches the bit patterns read for "@<path>" arguments during one Apply,
+// which looks them up again on every pass of the command string.
+type patternFiles map[string]string
+
+// resolve returns the binary string for a logical op pattern: "@<path>" reads the
+// pattern from a file (8 bits per byte), and "0x" patterns are expanded from hex.
+func (files patternFiles) resolve(pattern string, command rune) (string, error) {
+	if !strings.HasPrefix(pattern, "@") {
+		return expandHexPattern(pattern, command)
+	}
+	path := strings.TrimSuffix(pattern[1:], ";")
+	if cached, ok := files[path]; ok {
+		return cached, nil
+	}
+	if path == "" {
+		return "", fmt.Errorf("pattern file for command '%c' has no path", command)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading pattern file for command '%c': %v", command, err)
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("pattern file %s for command '%c' is empty", path, command)
+	}
+	files[path] = string(ToASCII(data))
+	return files[path], nil
+}
+
+// expandHexPattern turns a "0x"-prefixed pattern into the equivalent binary string, four
+// bits per hex digit. Other patterns are returned unchanged.
+func expandHexPattern(pattern string, command rune) (string, error) {
+	if !strings.HasPrefix(pattern, "0x") {
+		return pattern, nil
+	}
+	digits := strings.TrimSuffix(pattern[2:], ";")
+	if digits == "" {
+		return "", fmt.Errorf("hex pattern for command '%c' has no digits", command)
+	}
+	var expanded strings.Builder
+	for _, digit := range digits {
+		value, err := strconv.ParseUint(string(digit), 16, 4)
+		if err != nil {
+			return "", fmt.Errorf("invalid hex pattern for command '%c': %s (end a hex pattern with ';' before the next command)", command, pattern)
+		}
+		fmt.Fprintf(&expanded, "%04b", value)
+	}
+	return expanded.String(), nil
+}
+
+// applyLogicalOp writes inputBits[start:end] combined with the repeating pattern to out.
+// When start is byte-aligned and the pattern length divides 8, whole bytes are taken
+// from the packed data and combined with a byte-wide pattern; remaining bits fall
+// back to the bit-by-bit path.
+func applyLogicalOp(out *bytes.Buffer, data, inputBits []byte, start, end int, op rune, pattern string) {
+	// XNOR, NAND and NOR are XOR, AND and OR with the result inverted
+	var invert byte
+	if strings.ContainsRune("XAO", op) {
+		op = unicode.ToLower(op)
+		invert = 1
+	}
+	i := start
+	if start%8 == 0 && 8%len(pattern) == 0 {
+		var patternByte byte
+		for j := 0; j < 8; j++ {
+			patternByte = patternByte<<1 | (pattern[j%len(pattern)] - '0')
+		}
+		expanded := make([]byte, 8)
+		for ; i+8 <= end; i += 8 {
+			b := data[i/8]
+			switch op {
+			case 'x':
+				b ^= patternByte
+			case 'a':
+				b &= patternByte
+			case 'o':
+				b |= patternByte
+			}
+			if invert == 1 {
+				b = ^b
+			}
+			for j := 0; j < 8; j++ {
+				expanded[j] = (b >> (7 - j)) & 1
+			}
+			out.Write(expanded)
+		}
+	}
+
+	for ; i < end; i++ {
+		bit := inputBits[i]
+		patternBit := byte(pattern[(i-start)%len(pattern)] - '0')
+		var resultBit byte
+		switch op {
+		case 'x':
+			resultBit = bit ^ patternBit // XOR
+		case 'a':
+			resultBit = bit & patternBit // AND
+		case 'o':
+			resultBit = bit | patternBit // OR
+		}
+		out.WriteByte(resultBit ^ invert)
+	}
+}
+
+// applyBlockOps applies a series of transformations to a single chunk of bits.
+// offset is the position of subProgram in the whole command string, for error columns.
+// Each command is logged to logOut unless it is nil. "@<path>" patterns are read
+// through files.
+func applyBlockOps(initialChunk []byte, subProgram string, offset int, logOut io.Writer, files patternFiles) ([]byte, error) {
+	processedChunk := make([]byte, len(initialChunk))
+	copy(processedChunk, initialChunk)
+
+	cmdIdx := 0
+	for cmdIdx < len(subProgram) {
+		cmdStart := offset + cmdIdx
+		command := rune(subProgram[cmdIdx])
+		cmdIdx++
+
+		argStr := ""
+		if strings.ContainsRune("xaoIXAOlrLRd", command) {
+			nextCmdIdx := len(subProgram)
+			for i := cmdIdx; i < len(subProgram); i++ {
+				if strings.ContainsRune("nvxaoIXAOlrLRdGB", rune(subProgram[i])) {
+					nextCmdIdx = i
+					break
+				}
+			}
+			if end := patternArgEnd(subProgram, cmdIdx); end != -1 {
+				nextCmdIdx = end
+			}
+			argStr = subProgram[cmdIdx:nextCmdIdx]
+			cmdIdx = nextCmdIdx
+		}
+
+		if logOut != nil {
+			logArg := argStr
+			if logArg != "" {
+				logArg = " with arg \"" + logArg + "\""
+			}
+			name := commandNames[command]
+			if command == 'l' {
+				name = "Rotate Left"
+			}
+			fmt.Fprintf(logOut, "    -> Applying block command '%s'%s\n", name, logArg)
+		}
+
+		switch command {
+		case 'n':
+			for i, bit := range processedChunk {
+				processedChunk[i] = 1 - bit
+			}
+		case 'G', 'B':
+			processedChunk = grayCode(processedChunk, command == 'B')
+		case 'v':
+			for i, j := 0, len(processedChunk)-1; i < j; i, j = i+1, j-1 {
+				processedChunk[i], processedChunk[j] = processedChunk[j], processedChunk[i]
+			}
+		case 'b':
+			numBytes := len(processedChunk) / 8
+			if numBytes > 1 {
+				tempChunk := make([]byte, len(processedChunk))
+				copy(tempChunk, processedChunk)
+				for i := 0; i < numBytes; i++ {
+					destByteStart := i * 8
+					sourceByteIndex := numBytes - 1 - i
+					sourceByteStart := sourceByteIndex * 8
+					copy(processedChunk[destByteStart:destByteStart+8], tempChunk[sourceByteStart:sourceByteStart+8])
+				}
+			}
+		case 'x', 'a', 'o', 'I', 'X', 'A', 'O':
+			if !strings.Contains(argStr, ":") {
+				return nil, errorAt(cmdStart, "logical op '%c' in block requires a pattern (e.g., x:101)", command)
+			}
+			parts := strings.SplitN(argStr, ":", 2)
+			pattern, err := files.resolve(parts[1], command)
+			if err != nil {
+				return nil, errorAt(cmdStart, "%v", err)
+			}
+			if len(pattern) == 0 {
+				return nil, errorAt(cmdStart, "pattern for '%c' cannot be empty", command)
+			}
+			for i, bit := range processedChunk {
+				patternBit := byte(pattern[i%len(pattern)] - '0')
+				var resultBit byte
+				switch command {
+				case 'x', 'I':
+					resultBit = bit ^ patternBit
+				case 'a':
+					resultBit = bit & patternBit
+				case 'o':
+					resultBit = bit | patternBit
+				case 'X':
+					resultBit = 1 - (bit ^ patternBit)
+				case 'A':
+					resultBit = 1 - (bit & patternBit)
+				case 'O':
+					resultBit = 1 - (bit | patternBit)
+				}
+				processedChunk[i] = resultBit
+			}
+		case 'l', 'r', 'L', 'R', 'd':
+			amount, err := strconv.Atoi(strings.TrimPrefix(argStr, ":"))
+			if !strings.HasPrefix(argStr, ":") || err != nil || amount < 0 {
+				return nil, errorAt(cmdStart, "%s '%c' in block requires an amount (e.g., %c:3)", wordOpKind(command), command, command)
+			}
+			switch command {
+			case 'l', 'r':
+				processedChunk = rotateBits(processedChunk, amount, command == 'l')
+			case 'd':
+				processedChunk = bytes.Repeat(processedChunk, amount)
+			default:
+				processedChunk = shiftBits(processedChunk, amount, command == 'L')
+			}
+		case 't', 's', 'i':
+			return nil, errorAt(cmdStart, "command '%c' not allowed in block operation", command)
+		default:
+			return nil, errorAt(cmdStart, "unknown command '%c' in block operation", command)
+		}
+	}
+	return processedChunk, nil
+}
+
+// CommandError is a problem with one command of the edit string, located by its
+// 1-based column in Program.Commands so that long programs can be fixed without
+// counting characters. Program.Describe locates it in the text as written.
+type CommandError struct {
+	Column int
+	Msg    string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// errorAt returns a CommandError for the command starting at 0-based index pos.
+func errorAt(pos int, format string, args ...interface{}) *CommandError {
+	return &CommandError{Column: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// commandDelimiters are the characters that start a new command, ending the argument
+// of the one before. A ']' outside a block ends it too, so that it is reported as a
+// stray bracket rather than as part of the argument.
+const commandDelimiters = "tsnivVxaoIXAObdDFlrLRgGBpPzZ*[]"
+
+// Program is an edit command string with '#' comments and the whitespace between
+// commands removed. Whitespace that is followed by anything other than a command, a
+// bracket or the end is kept, so that it is still rejected inside an argument, and
+// a "0x" or "@" pattern, whose letters would otherwise look like commands, is kept
+// as written up to its ';' or the end of its line.
+type Program struct {
+	commands string
+	lines    []string // the text as written
+	line     []int    // 0-based line of each character of commands
+	column   []int    // 1-based column of each character of commands
+}
+
+// Parse removes the comments and layout from text. It does not check the commands;
+// Check reports syntax errors, and Apply stops at the first one it reaches.
+func Parse(text string) *Program {
+	p := &Program{lines: strings.Split(strings.TrimSuffix(text, "\n"), "\n")}
+	var commands strings.Builder
+	write := func(c byte, line, column int) {
+		commands.WriteByte(c)
+		p.line = append(p.line, line)
+		p.column = append(p.column, column)
+	}
+	inBlock := false
+	for li, line := range p.lines {
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if commands.Len() > 0 {
+			// A line break only separates commands, like other whitespace
+			if next := strings.TrimLeft(line, " \t\r"); next != "" && !strings.ContainsRune(commandDelimiters, rune(next[0])) {
+				write(' ', li, 1)
+			}
+		}
+		for ci := 0; ci < len(line); ci++ {
+			if line[ci] == ':' {
+				// In a block the ']' also ends the pattern, as in applyBlockOps
+				argLine := line
+				if inBlock {
+					if i := strings.IndexByte(line[ci:], ']'); i != -1 {
+						argLine = line[:ci+i]
+					}
+				}
+				if end := patternArgEnd(argLine, ci); end != -1 {
+					for ; ci < end; ci++ {
+						write(line[ci], li, ci+1)
+					}
+					// The end of the line also ends the pattern
+					if end == len(line) && line[end-1] != ';' {
+						write(';', li, end+1)
+					}
+					ci--
+					continue
+				}
+			}
+			switch line[ci] {
+			case '[':
+				inBlock = true
+			case ']':
+				inBlock = false
+			}
+			if c := line[ci]; c == ' ' || c == '\t' || c == '\r' {
+				next := strings.TrimLeft(line[ci:], " \t\r")
+				if strings.ContainsRune(commandDelimiters, rune(next[0])) {
+					continue
+				}
+			}
+			write(line[ci], li, ci+1)
+		}
+	}
+	p.commands = commands.String()
+	return p
+}
+
+// Commands returns the program with comments and layout removed, as it is run.
+func (p *Program) Commands() string {
+	return p.commands
+}
+
+// Describe formats err with its place in the text as written and a caret under it.
+func (p *Program) Describe(err *CommandError) string {
+	line, column := 0, 1
+	if i := err.Column - 1; i < len(p.line) {
+		line, column = p.line[i], p.column[i]
+	} else if len(p.line) > 0 {
+		// Just past the last command, e.g. a missing block count
+		line, column = p.line[len(p.line)-1], p.column[len(p.column)-1]+1
+	}
+	location := fmt.Sprintf("column %d", column)
+	if len(p.lines) > 1 {
+		location = fmt.Sprintf("line %d, column %d", line+1, column)
+	}
+	text := strings.TrimRight(p.lines[line], "\r")
+	// Keep tabs in the padding so the caret lines up with the text above it
+	padding := []byte(text)
+	if column-1 < len(padding) {
+		padding = padding[:column-1]
+	}
+	for i, c := range padding {
+		if c != '\t' {
+			padding[i] = ' '
+		}
+	}
+	return fmt.Sprintf("%s: %s\n  %s\n  %s^", location, err.Msg, text, string(padding)+strings.Repeat(" ", column-1-len(padding)))
+}
+
+// Check checks the syntax of the program without any input data. It follows the same
+// parsing rules as Apply, but carries on after an error so that every problem is
+// reported, each with its column in Commands. sampleWidth is the 'g' sample width.
+func (p *Program) Check(sampleWidth int) []*CommandError {
+	commands := p.commands
+	var problems []*CommandError
+	report := func(pos int, format string, args ...interface{}) {
+		problems = append(problems, errorAt(pos, format, args...))
+	}
+	scanDigits := func(from int) int {
+		for from < len(commands) && commands[from] >= '0' && commands[from] <= '9' {
+			from++
+		}
+		return from
+	}
+	checkPattern := func(pos int, command byte, pattern string) {
+		if command != 'i' && strings.HasPrefix(pattern, "@") {
+			// The file is only read when the program runs
+			if strings.TrimSuffix(pattern[1:], ";") == "" {
+				report(pos, "pattern file for command '%c' has no path", command)
+			}
+			return
+		}
+		if command != 'i' {
+			expanded, err := expandHexPattern(pattern, rune(command))
+			if err != nil {
+				report(pos, "%v", err)
+				return
+			}
+			pattern = expanded
+		}
+		if pattern == "" {
+			report(pos, "binary pattern for command '%c' cannot be empty", command)
+			return
+		}
+		for _, p := range pattern {
+			if p != '0' && p != '1' {
+				report(pos, "invalid binary pattern for command '%c': %s", command, pattern)
+				return
+			}
+		}
+	}
+
+	cmdIdx := 0
+	for cmdIdx < len(commands) {
+		pos := cmdIdx
+		command := commands[cmdIdx]
+
+		switch command {
+		case ']':
+			report(pos, "']' without a matching '['")
+			cmdIdx++
+			continue
+		case '[':
+			endBracketIdx := strings.IndexByte(commands[pos+1:], ']')
+			if endBracketIdx == -1 {
+				report(pos, "mismatched brackets in command string: '[' is never closed")
+				return problems
+			}
+			endBracketIdx += pos + 1
+			subProgram := commands[pos+1 : endBracketIdx]
+			if nested := strings.IndexByte(subProgram, '['); nested != -1 {
+				report(pos+1+nested, "blocks cannot be nested")
+			}
+			for i := 0; i < len(subProgram); i++ {
+				subPos := pos + 1 + i
+				subCommand := subProgram[i]
+				switch subCommand {
+				case 'n', 'v', 'b', 'G', 'B':
+				case 'x', 'a', 'o', 'I', 'X', 'A', 'O', 'l', 'r', 'L', 'R', 'd':
+					argEnd := i + 1
+					for argEnd < len(subProgram) && !strings.ContainsRune("nvxaoIXAOlrLRdGB", rune(subProgram[argEnd])) {
+						argEnd++
+					}
+					if end := patternArgEnd(subProgram, i+1); end != -1 {
+						argEnd = end
+					}
+					argStr := subProgram[i+1 : argEnd]
+					if strings.ContainsRune("lrLRd", rune(subCommand)) {
+						if amount, err := strconv.Atoi(strings.TrimPrefix(argStr, ":")); !strings.HasPrefix(argStr, ":") || err != nil || amount < 0 {
+							report(subPos, "%s '%c' in block requires an amount (e.g., %c:3)", wordOpKind(rune(subCommand)), subCommand, subCommand)
+						}
+					} else if !strings.HasPrefix(argStr, ":") {
+						report(subPos, "logical op '%c' in block requires a pattern (e.g., x:101)", subCommand)
+					} else {
+						checkPattern(subPos, subCommand, argStr[1:])
+					}
+					i = argEnd - 1
+				case 't', 's', 'i':
+					report(subPos, "command '%c' not allowed in block operation", subCommand)
+				case '[':
+				default:
+					report(subPos, "unknown command '%c' in block operation", subCommand)
+				}
+			}
+
+			numEndIdx := scanDigits(endBracketIdx + 1)
+			if numEndIdx == endBracketIdx+1 {
+				report(endBracketIdx+1, "block operation must be followed by a number")
+			}
+			if numEndIdx < len(commands) && commands[numEndIdx] == '!' {
+				widthEndIdx := scanDigits(numEndIdx + 1)
+				width := commands[numEndIdx+1 : widthEndIdx]
+				if width != "8" && width != "16" && width != "32" {
+					report(numEndIdx+1, "invalid CRC width for block operation: %s (must be 8, 16 or 32)", width)
+				}
+				numEndIdx = widthEndIdx
+			}
+			cmdIdx = numEndIdx
+			continue
+		case '*', 'V':
+			cmdIdx++
+			continue
+		case 'l':
+			numEndIdx := scanDigits(pos + 1)
+			if numEndIdx > pos+1 && numEndIdx < len(commands) && commands[numEndIdx] == ':' {
+				amountEndIdx := scanDigits(numEndIdx + 1)
+				if amountEndIdx == numEndIdx+1 {
+					report(numEndIdx+1, "invalid rotate amount for 'l' command: missing")
+				}
+				cmdIdx = amountEndIdx
+				continue
+			}
+			if numEndIdx == pos+1 || numEndIdx >= len(commands) || commands[numEndIdx] != 't' {
+				report(pos, "invalid length-prefixed take: expected l<width>t or l<N>:<K>")
+				cmdIdx = numEndIdx
+				continue
+			}
+			if width, err := strconv.Atoi(commands[pos+1 : numEndIdx]); err != nil || width <= 0 || width > 62 {
+				report(pos+1, "invalid length field width for 'l' command: %s", commands[pos+1:numEndIdx])
+			}
+			cmdIdx = numEndIdx + 1
+			continue
+		}
+
+		// Simple commands take everything up to the next command letter as their argument
+		cmdIdx++
+		for cmdIdx < len(commands) && !strings.ContainsRune(commandDelimiters, rune(commands[cmdIdx])) {
+			cmdIdx++
+		}
+		if strings.ContainsRune("xaoIXAO", rune(command)) {
+			if end := patternArgEnd(commands, pos+1); end != -1 {
+				cmdIdx = end
+			}
+		}
+		argStr := commands[pos+1 : cmdIdx]
+
+		switch command {
+		case 't', 's', 'n', 'v', 'b', 'D', 'F', 'g', 'G', 'B', 'z', 'Z':
+			count, err := strconv.Atoi(argStr)
+			if err != nil {
+				report(pos, "invalid numeric argument for command '%c': %q", command, argStr)
+			} else if command == 'b' && count%8 != 0 {
+				report(pos, "argument for 'b' command must be a multiple of 8, got %d", count)
+			} else if command == 'g' && count%sampleWidth != 0 {
+				report(pos, "argument for 'g' command must be a multiple of the sample width (%d), got %d", sampleWidth, count)
+			}
+		case 'i':
+			checkPattern(pos, command, argStr)
+		case 'p':
+			if argStr != "0" && argStr != "1" {
+				report(pos, "argument for 'p' command must be the fill bit 0 or 1, got %q", argStr)
+			}
+		case 'P':
+			if count, err := strconv.Atoi(argStr); err != nil || count <= 0 {
+				report(pos, "argument for 'P' command must be a number of bits > 0, got %q", argStr)
+			}
+		case 'x', 'a', 'o', 'I', 'X', 'A', 'O':
+			parts := strings.SplitN(argStr, ":", 2)
+			if len(parts) != 2 {
+				report(pos, "invalid argument for command '%c': expected <number>:<pattern>, got %q", command, argStr)
+				continue
+			}
+			if _, err := strconv.Atoi(parts[0]); err != nil {
+				report(pos, "invalid numeric count for command '%c': %q", command, parts[0])
+			}
+			checkPattern(pos, command, parts[1])
+		case 'r', 'L', 'R', 'd':
+			parts := strings.SplitN(argStr, ":", 2)
+			if len(parts) != 2 {
+				report(pos, "invalid argument for command '%c': expected <number>:<amount>, got %q", command, argStr)
+				continue
+			}
+			if _, err := strconv.Atoi(parts[0]); err != nil {
+				report(pos, "invalid numeric count for command '%c': %q", command, parts[0])
+			}
+			if amount, err := strconv.Atoi(parts[1]); err != nil || amount < 0 {
+				report(pos, "invalid amount for command '%c': %q", command, parts[1])
+			}
+		default:
+			report(pos, "unknown command: %c", command)
+		}
+	}
+	return problems
+}
+
+// Apply parses commands and runs them over data; see Program.Apply.
+func Apply(data []byte, commands string, opts Options) ([]byte, error) {
+	return Parse(commands).Apply(data, opts)
+}
+
+// Apply runs the program over data, repeating it until the end of the range, and
+// returns the packed output. Errors in a command are returned as *CommandError.
+func (p *Program) Apply(data []byte, opts Options) ([]byte, error) {
+	commands := p.commands
+	startBit, endBit := opts.StartBit, opts.EndBit
+	logOut := opts.Verbose
+	verbose, verboseOnce := logOut != nil, opts.VerboseOnce
+	if opts.SampleWidth == 0 {
+		opts.SampleWidth = 16
+	}
+
+	inputBits := bitio.BytesToBits(data)
+	outputBits := new(bytes.Buffer)
+	files := patternFiles{}
+
+	// Validate and adjust start/end bits
+	if startBit < 0 || startBit > len(inputBits) {
+		return nil, fmt.Errorf("start bit (%d) is out of bounds", startBit)
+	}
+	if endBit <= 0 || endBit > len(inputBits) {
+		endBit = len(inputBits)
+	}
+	if startBit > endBit {
+		return nil, fmt.Errorf("start bit (%d) cannot be greater than end bit (%d)", startBit, endBit)
+	}
+
+	if verbose {
+		fmt.Fprintf(logOut, "Starting edit process. Total input bits: %d. Processing range: %d to %d.\n", len(inputBits), startBit, endBit)
+	}
+
+	if opts.Splice {
+		outputBits.Write(inputBits[:startBit])
+	}
+	editedStart := outputBits.Len()
+
+	inputPos := startBit
+	logPrinted := false
+	var segmentEnds []int // output bit offsets where a block or pass finished
+
+	// Differential coding state persists across repetitions of the command string
+	var prevEncodedBit, prevDecodedInputBit byte
+
+	// Main loop to repeat the command pattern until the end of the specified range
+	iteration := 0
+	for inputPos < endBit {
+		if len(commands) == 0 || (opts.Repeat > 0 && iteration == opts.Repeat) {
+			break
+		}
+		iteration++
+		passStart := inputPos
+		if verbose && (!verboseOnce || !logPrinted) {
+			if opts.Repeat > 0 {
+				fmt.Fprintf(logOut, "Iteration %d of %d at input bit %d\n", iteration, opts.Repeat, inputPos)
+			} else {
+				fmt.Fprintf(logOut, "Iteration %d at input bit %d\n", iteration, inputPos)
+			}
+		}
+
+		cmdIdx := 0
+		for cmdIdx < len(commands) {
+			// Tee markers and padding need no input, so ones that end the program still run
+			if inputPos >= endBit && !strings.ContainsRune("*pP", rune(commands[cmdIdx])) {
+				break
+			}
+
+			cmdStart := cmdIdx
+			command := rune(commands[cmdIdx])
+			bitsBefore := outputBits.Len()
+			shouldLog := verbose && (!verboseOnce || !logPrinted)
+
+			if command == ']' {
+				return nil, errorAt(cmdStart, "']' without a matching '['")
+			}
+			if command == '[' {
+				cmdIdx++ // Move past '['
+				endBracketIdx := strings.IndexRune(commands[cmdIdx:], ']')
+				if endBracketIdx == -1 {
+					return nil, errorAt(cmdStart, "mismatched brackets in command string")
+				}
+				endBracketIdx += cmdIdx
+				subProgram := commands[cmdIdx:endBracketIdx]
+
+				numStartIdx := endBracketIdx + 1
+				numEndIdx := numStartIdx
+				for numEndIdx < len(commands) && commands[numEndIdx] >= '0' && commands[numEndIdx] <= '9' {
+					numEndIdx++
+				}
+
+				if numStartIdx == numEndIdx {
+					return nil, errorAt(cmdStart, "block operation must be followed by a number")
+				}
+
+				count, err := strconv.Atoi(commands[numStartIdx:numEndIdx])
+				if err != nil {
+					return nil, errorAt(cmdStart, "invalid number for block operation: %s", commands[numStartIdx:numEndIdx])
+				}
+
+				// Optional per-block CRC trailer: [chain]<N>!<width>
+				crcWidth := 0
+				if numEndIdx < len(commands) && commands[numEndIdx] == '!' {
+					widthStartIdx := numEndIdx + 1
+					numEndIdx = widthStartIdx
+					for numEndIdx < len(commands) && commands[numEndIdx] >= '0' && commands[numEndIdx] <= '9' {
+						numEndIdx++
+					}
+					crcWidth, err = strconv.Atoi(commands[widthStartIdx:numEndIdx])
+					if err != nil || (crcWidth != 8 && crcWidth != 16 && crcWidth != 32) {
+						return nil, errorAt(cmdStart, "invalid CRC width for block operation: %s (must be 8, 16 or 32)", commands[widthStartIdx:numEndIdx])
+					}
+				}
+
+				if shouldLog {
+					fmt.Fprintf(logOut, "Processing block command \"[%s]%d\" at input bit %d\n", subProgram, count, inputPos)
+				}
+
+				readEnd := inputPos + count
+				if readEnd > endBit {
+					readEnd = endBit
+				}
+
+				chunk := inputBits[inputPos:readEnd]
+				var blockLog io.Writer
+				if shouldLog {
+					blockLog = logOut
+				}
+				processedChunk, err := applyBlockOps(chunk, subProgram, cmdStart+1, blockLog, files)
+				if err != nil {
+					return nil, err
+				}
+
+				outputBits.Write(processedChunk)
+				if crcWidth != 0 {
+					outputBits.Write(crcBits(processedChunk, crcWidth))
+				}
+				segmentEnds = append(segmentEnds, outputBits.Len())
+				inputPos = readEnd
+				cmdIdx = numEndIdx
+
+				if shouldLog {
+					bitsAfter := outputBits.Len()
+					fmt.Fprintf(logOut, " -> Wrote %d bits to output.\n", bitsAfter-bitsBefore)
+				}
+				continue
+			}
+
+			if command == '*' {
+				cmdIdx++
+				if opts.Tee != nil {
+					if shouldLog {
+						fmt.Fprintf(logOut, "Processing '%s' command: writing %d output bits to the tee file\n", commandNames[command], outputBits.Len())
+					}
+					if err := opts.Tee(bitio.BitsToBytes(outputBits.Bytes())); err != nil {
+						return nil, fmt.Errorf("writing tee file: %v", err)
+					}
+				}
+				continue
+			}
+
+			if command == 'V' {
+				// The range end is only known now, so this reverses whatever is left of it
+				cmdIdx++
+				if shouldLog {
+					fmt.Fprintf(logOut, "Processing '%s' command: reversing input bits %d to %d\n", commandNames[command], inputPos, endBit)
+				}
+				chunk := inputBits[inputPos:endBit]
+				for i := len(chunk) - 1; i >= 0; i-- {
+					outputBits.WriteByte(chunk[i])
+				}
+				inputPos = endBit
+				continue
+			}
+
+			if command == 'l' {
+				cmdIdx++ // Move past 'l'
+				numEndIdx := cmdIdx
+				for numEndIdx < len(commands) && commands[numEndIdx] >= '0' && commands[numEndIdx] <= '9' {
+					numEndIdx++
+				}
+				if numEndIdx > cmdIdx && numEndIdx < len(commands) && commands[numEndIdx] == ':' {
+					// l<N>:<K> is a left rotate rather than a length-prefixed take
+					count, _ := strconv.Atoi(commands[cmdIdx:numEndIdx])
+					amountStartIdx := numEndIdx + 1
+					amountEndIdx := amountStartIdx
+					for amountEndIdx < len(commands) && commands[amountEndIdx] >= '0' && commands[amountEndIdx] <= '9' {
+						amountEndIdx++
+					}
+					amount, err := strconv.Atoi(commands[amountStartIdx:amountEndIdx])
+					if err != nil {
+						return nil, errorAt(cmdStart, "invalid rotate amount for 'l' command: %s", commands[amountStartIdx:amountEndIdx])
+					}
+					cmdIdx = amountEndIdx
+
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					if shouldLog {
+						fmt.Fprintf(logOut, "Processing 'Rotate Left' command with arg \"%d:%d\" at input bit %d\n", count, amount, inputPos)
+					}
+					outputBits.Write(rotateBits(inputBits[inputPos:readEnd], amount, true))
+					inputPos = readEnd
+
+					if shouldLog {
+						bitsAfter := outputBits.Len()
+						fmt.Fprintf(logOut, " -> Wrote %d bits to output.\n", bitsAfter-bitsBefore)
+					}
+					continue
+				}
+				if numEndIdx == cmdIdx || numEndIdx >= len(commands) || commands[numEndIdx] != 't' {
+					return nil, errorAt(cmdStart, "invalid length-prefixed take: expected l<width>t or l<N>:<K>")
+				}
+				width, err := strconv.Atoi(commands[cmdIdx:numEndIdx])
+				if err != nil || width <= 0 || width > 62 {
+					return nil, errorAt(cmdStart, "invalid length field width for 'l' command: %s", commands[cmdIdx:numEndIdx])
+				}
+				cmdIdx = numEndIdx + 1 // Move past 't'
+
+				fieldEnd := inputPos + width
+				if fieldEnd > endBit {
+					if opts.StrictBounds {
+						return nil, errorAt(cmdStart, "length field at bit %d runs past the end of the range (%d)", inputPos, endBit)
+					}
+					fieldEnd = endBit
+				}
+				length := 0
+				for _, bit := range inputBits[inputPos:fieldEnd] {
+					length = (length << 1) | int(bit)
+				}
+				inputPos = fieldEnd
+
+				readEnd := inputPos + length
+				if readEnd > endBit {
+					if opts.StrictBounds {
+						return nil, errorAt(cmdStart, "length-prefixed take of %d bits at bit %d exceeds the end of the range (%d)", length, inputPos, endBit)
+					}
+					readEnd = endBit
+				}
+
+				if shouldLog {
+					fmt.Fprintf(logOut, "Processing '%s' command with width %d: length field = %d at input bit %d\n", commandNames[command], width, length, fieldEnd-width)
+				}
+
+				outputBits.Write(inputBits[inputPos:readEnd])
+				inputPos = readEnd
+
+				if shouldLog {
+					bitsAfter := outputBits.Len()
+					fmt.Fprintf(logOut, " -> Wrote %d bits to output.\n", bitsAfter-bitsBefore)
+				}
+				continue
+			}
+
+			cmdIdx++
+			// --- Argument Parsing for simple commands ---
+			argStart := cmdIdx
+			argEnd := cmdIdx
+			nextCmdIdx := len(commands)
+			for i := cmdIdx; i < len(commands); i++ {
+				if strings.ContainsRune(commandDelimiters, rune(commands[i])) {
+					nextCmdIdx = i
+					break
+				}
+			}
+			if strings.ContainsRune("xaoIXAO", command) {
+				if end := patternArgEnd(commands, argStart); end != -1 {
+					nextCmdIdx = end
+				}
+			}
+			argEnd = nextCmdIdx
+			argStr := commands[argStart:argEnd]
+			cmdIdx = argEnd
+			// --- End Argument Parsing ---
+
+			if shouldLog {
+				fmt.Fprintf(logOut, "Processing '%s' command with arg \"%s\" at input bit %d\n", commandNames[command], argStr, inputPos)
+			}
+
+			switch command {
+			case 't', 's', 'n', 'v', 'b', 'D', 'F', 'g', 'G', 'B', 'z', 'Z':
+				count, err := strconv.Atoi(argStr)
+				if err != nil {
+					return nil, errorAt(cmdStart, "invalid numeric argument for command '%c': %s", command, argStr)
+				}
+
+				switch command {
+				case 't':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					outputBits.Write(inputBits[inputPos:readEnd])
+					inputPos = readEnd
+				case 's':
+					inputPos += count
+				case 'n':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					for _, bit := range inputBits[inputPos:readEnd] {
+						outputBits.WriteByte(1 - bit)
+					}
+					inputPos = readEnd
+				case 'v':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					chunk := inputBits[inputPos:readEnd]
+					for i := len(chunk) - 1; i >= 0; i-- {
+						outputBits.WriteByte(chunk[i])
+					}
+					inputPos = readEnd
+				case 'b':
+					if count%8 != 0 {
+						return nil, errorAt(cmdStart, "argument for 'b' command must be a multiple of 8, got %d", count)
+					}
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					chunk := inputBits[inputPos:readEnd]
+					numBytes := len(chunk) / 8
+					if numBytes > 0 {
+						for i := numBytes - 1; i >= 0; i-- {
+							byteStart := i * 8
+							outputBits.Write(chunk[byteStart : byteStart+8])
+						}
+					}
+					// Write any remaining bits that don't form a full byte
+					if len(chunk)%8 != 0 {
+						outputBits.Write(chunk[numBytes*8:])
+					}
+					inputPos = readEnd
+				case 'D':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					for _, bit := range inputBits[inputPos:readEnd] {
+						prevEncodedBit ^= bit
+						outputBits.WriteByte(prevEncodedBit)
+					}
+					inputPos = readEnd
+				case 'F':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					for _, bit := range inputBits[inputPos:readEnd] {
+						outputBits.WriteByte(bit ^ prevDecodedInputBit)
+						prevDecodedInputBit = bit
+					}
+					inputPos = readEnd
+				case 'g':
+					if count%opts.SampleWidth != 0 {
+						return nil, errorAt(cmdStart, "argument for 'g' command must be a multiple of the sample width (%d), got %d", opts.SampleWidth, count)
+					}
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					outputBits.Write(flipSign(inputBits[inputPos:readEnd], opts.SampleWidth, opts.SampleSigned, opts.SampleLittle))
+					inputPos = readEnd
+				case 'G', 'B':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					outputBits.Write(grayCode(inputBits[inputPos:readEnd], command == 'B'))
+					inputPos = readEnd
+				case 'z', 'Z':
+					readEnd := inputPos + count
+					if readEnd > endBit {
+						readEnd = endBit
+					}
+					fill := byte(0)
+					if command == 'Z' {
+						fill = 1
+					}
+					for i := inputPos; i < readEnd; i++ {
+						outputBits.WriteByte(fill)
+					}
+					inputPos = readEnd
+				}
+
+			case 'i':
+				for _, char := range argStr {
+					if char != '0' && char != '1' {
+						return nil, errorAt(cmdStart, "invalid binary string for 'i' command: %s", argStr)
+					}
+					outputBits.WriteByte(byte(char - '0'))
+				}
+
+			case 'p', 'P':
+				multiple, fill := 8, byte(0)
+				if command == 'p' {
+					if argStr != "0" && argStr != "1" {
+						return nil, errorAt(cmdStart, "argument for 'p' command must be the fill bit 0 or 1, got %q", argStr)
+					}
+					fill = argStr[0] - '0'
+				} else {
+					var err error
+					multiple, err = strconv.Atoi(argStr)
+					if err != nil || multiple <= 0 {
+						return nil, errorAt(cmdStart, "argument for 'P' command must be a number of bits > 0, got %q", argStr)
+					}
+				}
+				padding := (multiple - outputBits.Len()%multiple) % multiple
+				for i := 0; i < padding; i++ {
+					outputBits.WriteByte(fill)
+				}
+				if shouldLog {
+					fmt.Fprintf(logOut, " -> Added %d fill bits.\n", padding)
+				}
+
+			case 'x', 'a', 'o', 'I', 'X', 'A', 'O':
+				parts := strings.SplitN(argStr, ":", 2)
+				if len(parts) != 2 {
+					return nil, errorAt(cmdStart, "invalid argument for command '%c': expected <number>:<pattern>, got %s", command, argStr)
+				}
+
+				count, err := strconv.Atoi(parts[0])
+				if err != nil {
+					return nil, errorAt(cmdStart, "invalid numeric count for command '%c': %s", command, parts[0])
+				}
+
+				pattern, err := files.resolve(parts[1], command)
+				if err != nil {
+					return nil, errorAt(cmdStart, "%v", err)
+				}
+				if len(pattern) == 0 {
+					return nil, errorAt(cmdStart, "binary pattern for command '%c' cannot be empty", command)
+				}
+				for _, p := range pattern {
+					if p != '0' && p != '1' {
+						return nil, errorAt(cmdStart, "invalid binary pattern for command '%c': %s", command, pattern)
+					}
+				}
+
+				readEnd := inputPos + count
+				if readEnd > endBit || (count == 0 && strings.HasPrefix(parts[1], "@")) {
+					// A file pattern with a count of 0 covers the rest of the range
+					readEnd = endBit
+				}
+
+				op := command
+				if op == 'I' {
+					// Inverting where the mask is 1 is exactly XOR with the mask
+					op = 'x'
+				}
+				applyLogicalOp(outputBits, data, inputBits, inputPos, readEnd, op, pattern)
+				inputPos = readEnd
+
+			case 'r', 'L', 'R', 'd':
+				parts := strings.SplitN(argStr, ":", 2)
+				if len(parts) != 2 {
+					return nil, errorAt(cmdStart, "invalid argument for command '%c': expected <number>:<amount>, got %s", command, argStr)
+				}
+				count, err := strconv.Atoi(parts[0])
+				if err != nil {
+					return nil, errorAt(cmdStart, "invalid numeric count for command '%c': %s", command, parts[0])
+				}
+				amount, err := strconv.Atoi(parts[1])
+				if err != nil || amount < 0 {
+					return nil, errorAt(cmdStart, "invalid amount for command '%c': %s", command, parts[1])
+				}
+				readEnd := inputPos + count
+				if readEnd > endBit {
+					readEnd = endBit
+				}
+				switch command {
+				case 'r':
+					outputBits.Write(rotateBits(inputBits[inputPos:readEnd], amount, false))
+				case 'd':
+					if shouldLog {
+						fmt.Fprintf(logOut, " -> Replicating %d source bits %d times (%d bits).\n", readEnd-inputPos, amount, (readEnd-inputPos)*amount)
+					}
+					for i := 0; i < amount; i++ {
+						outputBits.Write(inputBits[inputPos:readEnd])
+					}
+				default:
+					outputBits.Write(shiftBits(inputBits[inputPos:readEnd], amount, command == 'L'))
+				}
+				inputPos = readEnd
+
+			default:
+				return nil, errorAt(cmdStart, "unknown command: %c", command)
+			}
+
+			if shouldLog && command != 's' {
+				bitsAfter := outputBits.Len()
+				fmt.Fprintf(logOut, " -> Wrote %d bits to output.\n", bitsAfter-bitsBefore)
+			}
+		}
+		// A pass that reads nothing would run the same way forever without a repeat limit
+		if inputPos == passStart && inputPos < endBit && opts.Repeat == 0 {
+			return nil, errorAt(0, "program consumes no input, so it would repeat forever (use -repeat to run it a fixed number of times)")
+		}
+		logPrinted = true
+		if len(segmentEnds) == 0 || segmentEnds[len(segmentEnds)-1] < outputBits.Len() {
+			segmentEnds = append(segmentEnds, outputBits.Len())
+		}
+	}
+
+	if opts.ReverseRange {
+		edited := outputBits.Bytes()[editedStart:]
+		for i, j := 0, len(edited)-1; i < j; i, j = i+1, j-1 {
+			edited[i], edited[j] = edited[j], edited[i]
+		}
+	}
+	if opts.XorDelay > 0 {
+		selfXor(outputBits.Bytes()[editedStart:], opts.XorDelay, opts.XorInverse)
+	}
+	if opts.ReorderWords > 0 {
+		bitReverseReorder(outputBits.Bytes()[editedStart:], opts.ReorderWords, opts.ReorderWidth)
+	}
+
+	if opts.VerifyCRC > 0 {
+		edited := outputBits.Bytes()[editedStart:]
+		if len(edited) < opts.VerifyCRC {
+			return nil, fmt.Errorf("edited output (%d bits) is shorter than the %d-bit CRC", len(edited), opts.VerifyCRC)
+		}
+		params, ok := crcStandards[opts.VerifyCRC]
+		if !ok {
+			return nil, fmt.Errorf("unsupported CRC width %d for VerifyCRC (must be 8, 16 or 32)", opts.VerifyCRC)
+		}
+		payload, trailer := edited[:len(edited)-opts.VerifyCRC], edited[len(edited)-opts.VerifyCRC:]
+		var stored uint64
+		for _, bit := range trailer {
+			stored = stored<<1 | uint64(bit)
+		}
+		if computed := crc.Checksum(bitio.BitsToBytes(payload), params); computed != stored {
+			digits := (opts.VerifyCRC + 3) / 4
+			return nil, fmt.Errorf("CRC-%d mismatch: trailer is 0x%0*x, computed 0x%0*x", opts.VerifyCRC, digits, stored, digits, computed)
+		}
+		if verbose {
+			fmt.Fprintf(logOut, "CRC-%d verified over %d bits; stripping it.\n", opts.VerifyCRC, len(payload))
+		}
+		outputBits.Truncate(outputBits.Len() - opts.VerifyCRC)
+	}
+
+	if opts.Repeat > 0 && opts.TailCopy && inputPos < endBit {
+		if verbose {
+			fmt.Fprintf(logOut, "Copying the %d input bits left after %d iterations.\n", endBit-inputPos, iteration)
+		}
+		outputBits.Write(inputBits[inputPos:endBit])
+		segmentEnds = append(segmentEnds, outputBits.Len())
+	}
+
+	if opts.Segments != nil {
+		segStart := editedStart
+		for _, segEnd := range segmentEnds {
+			if segEnd > outputBits.Len() {
+				segEnd = outputBits.Len()
+			}
+			if segEnd > segStart {
+				*opts.Segments = append(*opts.Segments, bitio.BitsToBytes(outputBits.Bytes()[segStart:segEnd]))
+			}
+			segStart = segEnd
+		}
+	}
+
+	if opts.Splice {
+		outputBits.Write(inputBits[endBit:])
+	}
+
+	result := outputBits.Bytes()
+	if opts.FrameSync != nil {
+		result = insertFrameSync(result, opts.FrameSync, opts.FrameInterval)
+	}
+	if opts.BitCount != nil {
+		*opts.BitCount = len(result)
+	}
+	return bitio.BitsToBytes(result), nil
+}
@@ -0,0 +1,605 @@
+package bitedit
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PaulW-NZ/Bit-tools/bitio"
+	"github.com/PaulW-NZ/Bit-tools/crc"
+)
+
+// input is 10110001 00001111.
+var input = []byte{0xB1, 0x0F}
+
+func TestApplyCommands(t *testing.T) {
+	tests := []struct {
+		program string
+		want    string // hex of the output
+	}{
+		{"t8", "b10f"},
+		{"s4t4", "1f"},
+		{"i1111t8", "fb1f0f"},
+		{"n8", "4ef0"},
+		{"v8", "8df0"},
+		{"V", "f08d"},
+		{"z8", "0000"},
+		{"Z8", "ffff"},
+		{"t4p1", "bf1f0fff"},
+		{"b16", "0fb1"},
+		{"x8:1", "4ef0"},
+		{"x16:0xff00", "4e0f"},
+		{"a8:0x0f", "010f"},
+		{"o8:1000", "b98f"},
+		{"I8:11", "4ef0"},
+		{"X8:0x0f", "41ff"},
+		{"A8:1", "4ef0"},
+		{"O8:0", "4ef0"},
+		{"D16", "de0a"},
+		{"F16", "e988"},
+		{"G8", "e908"},
+		{"B8", "de0a"},
+		{"r8:1", "d887"},
+		{"l8:1", "631e"},
+		{"L8:2", "c43c"},
+		{"R8:2", "2c03"},
+		{"d8:2", "b1b10f0f"},
+		{"g16", "4ef1"},
+		{"[n]8", "4ef0"},
+		{"[v]16", "f08d"},
+		{"t8*", "b10f"},
+	}
+	for _, tt := range tests {
+		got, err := Apply(input, tt.program, Options{})
+		if err != nil {
+			t.Errorf("Apply(%q): %v", tt.program, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Apply(%q) = %x, want %s", tt.program, got, tt.want)
+		}
+	}
+}
+
+// TestHexPatterns checks that "0x" hex patterns run to the next ';' and that a binary
+// "0" followed by an 'x' command keeps its original meaning.
+func TestHexPatterns(t *testing.T) {
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{"a8:0x8:1", "00f0"},
+		{"[a:0x:1]16", "ffff"},
+		{"x8:0xf0;t8", "410f"},
+		{"x16:0xfb;", "4af4"},
+		{"x4:0xa;n4t8", "1e0f"},
+		{"[x:0xff;]8", "4ef0"},
+	}
+	for _, tt := range tests {
+		got, err := Apply(input, tt.program, Options{})
+		if err != nil {
+			t.Errorf("Apply(%q): %v", tt.program, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Apply(%q) = %x, want %s", tt.program, got, tt.want)
+		}
+	}
+
+	_, err := Apply(input, "x8:0xfft8", Options{})
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || !strings.Contains(cmdErr.Msg, "';'") {
+		t.Errorf("Apply(\"x8:0xfft8\") error = %v, want an invalid hex pattern error", err)
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	got, err := Apply(input, "n4", Options{StartBit: 4, EndBit: 12, Splice: true})
+	if err != nil || hex.EncodeToString(got) != "beff" {
+		t.Errorf("spliced n4 over bits 4-12 = %x, %v; want beff", got, err)
+	}
+
+	var log bytes.Buffer
+	if _, err := Apply(input, "t8", Options{Verbose: &log}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "Iteration 2 at input bit 8") {
+		t.Errorf("verbose log is missing the second pass:\n%s", log.String())
+	}
+
+	var snapshots []string
+	tee := func(snapshot []byte) error {
+		snapshots = append(snapshots, hex.EncodeToString(snapshot))
+		return nil
+	}
+	if _, err := Apply(input, "t8*", Options{Tee: tee}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(snapshots, ",") != "b1,b10f" {
+		t.Errorf("tee snapshots = %v, want [b1 b10f]", snapshots)
+	}
+}
+
+// TestParse checks which comments and whitespace Parse strips. Whitespace between
+// complete commands goes; whitespace inside a count or pattern stays, to be
+// rejected, and a "0x" or "@" pattern is kept as written up to its ';' or line end.
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text     string
+		commands string
+		valid    bool
+	}{
+		{"s16 t8 [n]8 # checksum", "s16t8[n]8", true},
+		{"# header\n  s16\t# skip\n  [ n v ]8\n", "s16[nv]8", true},
+		{"x8:0xf0 # mask\nt8", "x8:0xf0;t8", true},
+		{"x16:0xff; a8:1", "x16:0xff;a8:1", true},
+		{"a8:0x8:1 t8", "a8:0x8:1t8", true},
+		{"[x:0xff]8 t8", "[x:0xff]8t8", true},
+		{"[x:0xf\n]8", "[x:0xf;]8", true},
+		{"x8:@my dir/pattern.bin\nt8", "x8:@my dir/pattern.bin;t8", true},
+		{"x16:0xff a0;", "x16:0xff a0;", false},
+		{"t1 6", "t1 6", false},
+		{"t1\n6", "t1 6", false},
+		{"x8: 10", "x8: 10", false},
+		{"[n]\t8", "[n]\t8", false},
+	}
+	for _, tt := range tests {
+		p := Parse(tt.text)
+		if p.Commands() != tt.commands {
+			t.Errorf("Parse(%q).Commands() = %q, want %q", tt.text, p.Commands(), tt.commands)
+		}
+		if problems := p.Check(16); (len(problems) == 0) != tt.valid {
+			t.Errorf("Parse(%q).Check() = %v, want valid %t", tt.text, problems, tt.valid)
+		}
+	}
+}
+
+// TestPatternFile checks "@<path>" patterns at the top level, with a count of 0
+// for the whole range, and in a block chain. Each Apply reads the file afresh.
+func TestPatternFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my masks")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "mask.bin")
+	if err := os.WriteFile(path, []byte{0xF0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{"x0:@" + path, "41ff"},
+		{"x8:@" + path + ";t8", "410f"},
+		{"[x:@" + path + "]16", "41ff"},
+		{"a0:@" + path + "\n", "b000"},
+	}
+	for _, tt := range tests {
+		got, err := Apply(input, tt.program, Options{})
+		if err != nil || hex.EncodeToString(got) != tt.want {
+			t.Errorf("Apply(%q) = %x, %v; want %s", tt.program, got, err, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte{0x0F}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Apply(input, "x0:@"+path, Options{}); hex.EncodeToString(got) != "be00" {
+		t.Errorf("after rewriting the pattern file, x0 = %x, want be00", got)
+	}
+
+	_, err := Apply(input, "x0:@"+filepath.Join(dir, "missing.bin"), Options{})
+	if err == nil || !strings.Contains(err.Error(), "reading pattern file for command 'x'") {
+		t.Errorf("missing pattern file: error = %v", err)
+	}
+}
+
+// TestCheck checks the diagnostics Check gives for a valid program and for
+// malformed ones, each with its column in Commands.
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		program string
+		want    []string // "column: message"
+	}{
+		{"s16 t8 [n]8 # checksum", nil},
+		{"s8 x8", []string{"3: invalid argument for command 'x': expected <number>:<pattern>, got \"8\""}},
+		{"t4]", []string{"3: ']' without a matching '['"}},
+		{"t4[n]8]t4", []string{"7: ']' without a matching '['"}},
+		{"t4[n8", []string{"3: mismatched brackets in command string: '[' is never closed"}},
+		{"[n]t8", []string{"4: block operation must be followed by a number"}},
+		{"[n]", []string{"4: block operation must be followed by a number"}},
+		{"x8:102", []string{"1: invalid binary pattern for command 'x': 102"}},
+		{"i12 [x:0x1g]8", []string{
+			"1: invalid binary pattern for command 'i': 12",
+			"5: invalid hex pattern for command 'x': 0x1g (end a hex pattern with ';' before the next command)",
+		}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, problem := range Parse(tt.program).Check(16) {
+			got = append(got, fmt.Sprintf("%d: %s", problem.Column, problem.Msg))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("Check(%q) = %q, want %q", tt.program, got, tt.want)
+		}
+	}
+}
+
+// TestDescribe checks the location and caret Describe gives for an error on one
+// line, on a later line indented with a tab, and just past the end of the program.
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"s16 t8 x8", "column 8: invalid argument for command 'x': expected <number>:<pattern>, got \"8\"\n  s16 t8 x8\n         ^"},
+		{"s16 # header\n\tt8 x8", "line 2, column 5: invalid argument for command 'x': expected <number>:<pattern>, got \"8\"\n  \tt8 x8\n  \t   ^"},
+		{"t8 [n]", "column 7: block operation must be followed by a number\n  t8 [n]\n        ^"},
+	}
+	for _, tt := range tests {
+		p := Parse(tt.text)
+		problems := p.Check(16)
+		if len(problems) != 1 {
+			t.Errorf("Check(%q) = %v, want one problem", tt.text, problems)
+			continue
+		}
+		if got := p.Describe(problems[0]); got != tt.want {
+			t.Errorf("Describe for %q =\n%s\nwant\n%s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCommandError(t *testing.T) {
+	_, err := Apply(input, "s8 x8", Options{})
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Column != 3 {
+		t.Fatalf("Apply(\"s8 x8\") error = %v, want a CommandError at column 3", err)
+	}
+	_, err = Apply(input, "t4]", Options{})
+	if !errors.As(err, &cmdErr) || cmdErr.Column != 3 || cmdErr.Msg != "']' without a matching '['" {
+		t.Errorf("Apply(\"t4]\") error = %v, want a stray ']' at column 3", err)
+	}
+}
+
+// TestApplyNoInput checks that a program which reads no input stops with an error
+// rather than looping forever, unless a repeat limit is set.
+func TestApplyNoInput(t *testing.T) {
+	for _, program := range []string{"p1", "P3", "*", "i1", "i1t0"} {
+		_, err := Apply(input, program, Options{})
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) || !strings.Contains(cmdErr.Msg, "consumes no input") {
+			t.Errorf("Apply(%q) error = %v, want a consumes no input error", program, err)
+		}
+	}
+
+	got, err := Apply(input, "i1", Options{Repeat: 2, TailCopy: true})
+	if err != nil || hex.EncodeToString(got) != "ec43c0" {
+		t.Errorf("Apply(\"i1\") with Repeat 2 = %x, %v; want ec43c0", got, err)
+	}
+}
+
+// TestMaskedInvert checks that I inverts only the bits under a 1 in the mask, and
+// gives the same result as x with the same mask, both alone and inside a block.
+func TestMaskedInvert(t *testing.T) {
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{"I16:10", "1ba5"},
+		{"I16:0001", "a01e"},
+		{"I8:0t8", "b10f"},
+		{"[I:1100]16", "7dc3"},
+	}
+	for _, tt := range tests {
+		got, err := Apply(input, tt.program, Options{})
+		if err != nil || hex.EncodeToString(got) != tt.want {
+			t.Errorf("Apply(%q) = %x, %v; want %s", tt.program, got, err, tt.want)
+		}
+		xor, _ := Apply(input, strings.Replace(tt.program, "I", "x", 1), Options{})
+		if !bytes.Equal(got, xor) {
+			t.Errorf("Apply(%q) = %x, but the x form gives %x", tt.program, got, xor)
+		}
+	}
+}
+
+// TestFlipSign negates 16-bit samples in each format and byte order, then negates
+// them again. Only the most negative sample fails to round trip: it saturates to the
+// largest sample, which comes back as one more than where it started.
+func TestFlipSign(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		in      string
+		want    string
+		negBack string
+	}{
+		{"signed big", Options{SampleSigned: true}, "0001123480000000", "ffffedcc7fff0000", "0001123480010000"},
+		{"signed little", Options{SampleSigned: true, SampleLittle: true}, "0100341200800000", "ffffccedff7f0000", "0100341201800000"},
+		{"unsigned big", Options{}, "8000800100007fff", "80007fffffff8001", "8000800100017fff"},
+		{"signed 8-bit", Options{SampleWidth: 8, SampleSigned: true}, "017f8000", "ff817f00", "017f8100"},
+	}
+	for _, tt := range tests {
+		in, _ := hex.DecodeString(tt.in)
+		got, err := Apply(in, "g32", tt.opts)
+		if err != nil || hex.EncodeToString(got) != tt.want {
+			t.Errorf("%s: g32 = %x, %v; want %s", tt.name, got, err, tt.want)
+			continue
+		}
+		if back, _ := Apply(got, "g32", tt.opts); hex.EncodeToString(back) != tt.negBack {
+			t.Errorf("%s: negated twice = %x, want %s", tt.name, back, tt.negBack)
+		}
+	}
+
+	if _, err := Apply(input, "g12", Options{}); err == nil {
+		t.Error("g12 with 16-bit samples gave no error")
+	}
+}
+
+// TestBitReverseReorder reorders blocks of 8 nibbles by bit-reversed index, leaving
+// a final partial block alone, and checks that a second pass restores the input.
+func TestBitReverseReorder(t *testing.T) {
+	in := []byte{0x01, 0x23, 0x45, 0x67, 0x89}
+	opts := Options{ReorderWords: 8, ReorderWidth: 4}
+	got, err := Apply(in, "t40", opts)
+	if err != nil || hex.EncodeToString(got) != "0426153789" {
+		t.Fatalf("reorder = %x, %v; want 0426153789", got, err)
+	}
+	if back, _ := Apply(got, "t40", opts); !bytes.Equal(back, in) {
+		t.Errorf("reordering twice = %x, want %x", back, in)
+	}
+}
+
+// TestSegments checks the output is split after every block and every pass of the
+// command string, with a short final block in its own segment.
+func TestSegments(t *testing.T) {
+	in := []byte{0xB1, 0x0F, 0x5A}
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{"[n]16", "4ef0 a5"},
+		{"t8", "b1 0f 5a"},
+		{"t4[v]8", "b080 f5a0"}, // 12-bit segments, zero-padded
+	}
+	for _, tt := range tests {
+		var segments [][]byte
+		if _, err := Apply(in, tt.program, Options{Segments: &segments}); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, len(segments))
+		for i, segment := range segments {
+			got[i] = hex.EncodeToString(segment)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Apply(%q) segments = %v, want %s", tt.program, got, tt.want)
+		}
+	}
+}
+
+// TestBlockCRC checks each per-block trailer of "[n]12!<W>" against a CRC of that
+// block's inverted bits, zero-padded to whole bytes, computed outside bitedit.
+func TestBlockCRC(t *testing.T) {
+	in := []byte("\x12\x34\x56\x78\x9a\xbc")
+	crcs := map[int]func([]byte) uint64{
+		8: func(data []byte) uint64 {
+			return crc.Checksum(data, crc.Params{Width: 8, Poly: 0x39, RefIn: true, RefOut: true})
+		},
+		16: func(data []byte) uint64 {
+			return crc.Checksum(data, crc.Params{Width: 16, Poly: 0x8005, Init: 0xFFFF, RefIn: true, RefOut: true})
+		},
+		32: func(data []byte) uint64 { return uint64(crc32.ChecksumIEEE(data)) },
+	}
+	inBits := bitio.BytesToBits(in)
+	for width, sum := range crcs {
+		program := fmt.Sprintf("[n]12!%d", width)
+		got, err := Apply(in, program, Options{})
+		if err != nil {
+			t.Fatalf("Apply(%q): %v", program, err)
+		}
+		gotBits := bitio.BytesToBits(got)
+		for block := 0; block < 4; block++ {
+			frame := gotBits[block*(12+width):]
+			data := make([]byte, 12)
+			for i, bit := range inBits[block*12 : block*12+12] {
+				data[i] = bit ^ 1
+			}
+			if !bytes.Equal(frame[:12], data) {
+				t.Errorf("%s block %d = %v, want %v", program, block, frame[:12], data)
+			}
+			var trailer uint64
+			for _, bit := range frame[12 : 12+width] {
+				trailer = trailer<<1 | uint64(bit)
+			}
+			if want := sum(bitio.BitsToBytes(data)); trailer != want {
+				t.Errorf("%s block %d trailer = 0x%x, want 0x%x", program, block, trailer, want)
+			}
+		}
+	}
+}
+
+// TestVerifyCRC appends a CRC of each width as one block trailer, then verifies
+// and strips it in a second run, and checks that a corrupted frame, "023456789"
+// under the CRC of "123456789", is rejected.
+func TestVerifyCRC(t *testing.T) {
+	in := []byte("123456789")
+	for _, width := range []int{8, 16, 32} {
+		framed, err := Apply(in, fmt.Sprintf("[]72!%d", width), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Apply(framed, "t8", Options{VerifyCRC: width})
+		if err != nil || !bytes.Equal(got, in) {
+			t.Errorf("CRC-%d verified output = %q, %v; want %q", width, got, err, in)
+		}
+	}
+
+	framed, _ := Apply(in, "[]72!16", Options{})
+	if hex.EncodeToString(framed[9:]) != "4b37" {
+		t.Errorf("CRC-16 trailer = %x, want the CRC-16/MODBUS check value 4b37", framed[9:])
+	}
+	framed[0] ^= 1
+	_, err := Apply(framed, "t8", Options{VerifyCRC: 16})
+	if err == nil || err.Error() != "CRC-16 mismatch: trailer is 0x4b37, computed 0xdb3a" {
+		t.Errorf("corrupted frame: error = %v", err)
+	}
+}
+
+// TestLengthPrefixedTake parses 4-bit length fields, 0011 101 0010 11, and a
+// final field cut short by the end of the data. A length past the end is clamped,
+// or an error with StrictBounds.
+func TestLengthPrefixedTake(t *testing.T) {
+	got, err := Apply([]byte{0x3A, 0x58}, "l4t", Options{})
+	if err != nil || hex.EncodeToString(got) != "b8" {
+		t.Errorf("l4t over 3a58 = %x, %v; want b8 (10111)", got, err)
+	}
+
+	got, err = Apply([]byte{0xF5}, "l4t", Options{})
+	if err != nil || hex.EncodeToString(got) != "50" {
+		t.Errorf("l4t with a length of 15 and 4 bits left = %x, %v; want 50 (0101)", got, err)
+	}
+	_, err = Apply([]byte{0xF5}, "l4t", Options{StrictBounds: true})
+	if err == nil || !strings.Contains(err.Error(), "length-prefixed take of 15 bits at bit 4 exceeds the end of the range (8)") {
+		t.Errorf("l4t with StrictBounds: error = %v", err)
+	}
+}
+
+// TestSelfXor checks that a delay of 1 XORs each bit with the one before it, the
+// first with zero, and that the inverse recovers the input for several delays.
+func TestSelfXor(t *testing.T) {
+	// 1011000100001111 XOR 0101100010000111 = 1110100110001000
+	got, err := Apply(input, "t16", Options{XorDelay: 1})
+	if err != nil || hex.EncodeToString(got) != "e988" {
+		t.Errorf("self-XOR with delay 1 = %x, %v; want e988", got, err)
+	}
+	for _, delay := range []int{1, 3, 8, 15} {
+		encoded, _ := Apply(input, "t16", Options{XorDelay: delay})
+		back, err := Apply(encoded, "t16", Options{XorDelay: delay, XorInverse: true})
+		if err != nil || !bytes.Equal(back, input) {
+			t.Errorf("delay %d: inverse of %x = %x, %v; want %x", delay, encoded, back, err, input)
+		}
+	}
+}
+
+// TestReverseRange reverses bits 8-16 of three bytes under Splice, leaving the
+// bytes either side unchanged, and checks it composes with edits of the range.
+func TestReverseRange(t *testing.T) {
+	in := []byte{0xB1, 0x0F, 0x5A}
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{"t8", "b1f05a"},   // 00001111 reversed
+		{"n4t4", "b1ff5a"}, // 11111111 reversed
+		{"v8", "b10f5a"},   // reversed twice
+	}
+	for _, tt := range tests {
+		got, err := Apply(in, tt.program, Options{StartBit: 8, EndBit: 16, Splice: true, ReverseRange: true})
+		if err != nil || hex.EncodeToString(got) != tt.want {
+			t.Errorf("Apply(%q) reversing bits 8-16 = %x, %v; want %s", tt.program, got, err, tt.want)
+		}
+	}
+}
+
+// TestRepeat runs "n4s4" twice over three bytes, inverting 1011 and 0000, and
+// checks the 8 input bits left over are copied or dropped.
+func TestRepeat(t *testing.T) {
+	in := []byte{0xB1, 0x0F, 0x5A}
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "4fa0"},
+		{Options{Repeat: 2}, "4f"},
+		{Options{Repeat: 2, TailCopy: true}, "4f5a"},
+		{Options{Repeat: 5, TailCopy: true}, "4fa0"},
+	}
+	for _, tt := range tests {
+		got, err := Apply(in, "n4s4", tt.opts)
+		if err != nil || hex.EncodeToString(got) != tt.want {
+			t.Errorf("n4s4 with Repeat %d, TailCopy %t = %x, %v; want %s", tt.opts.Repeat, tt.opts.TailCopy, got, err, tt.want)
+		}
+	}
+
+	var log bytes.Buffer
+	if _, err := Apply(in, "n4s4", Options{Repeat: 2, Verbose: &log}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Iteration 1 of 2 at input bit 0", "Iteration 2 of 2 at input bit 8"} {
+		if !strings.Contains(log.String(), line) {
+			t.Errorf("verbose log is missing %q:\n%s", line, log.String())
+		}
+	}
+	if strings.Contains(log.String(), "Iteration 3") {
+		t.Errorf("verbose log shows a third pass:\n%s", log.String())
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	if got := string(ToASCII(input)); got != "1011000100001111" {
+		t.Errorf("ToASCII = %s", got)
+	}
+}
+
+// naiveLogicalOp is the bit-by-bit loop that applyLogicalOp's byte path replaces.
+func naiveLogicalOp(inputBits []byte, start, end int, op rune, pattern string) []byte {
+	var out []byte
+	for i := start; i < end; i++ {
+		bit, p := inputBits[i], pattern[(i-start)%len(pattern)]-'0'
+		var result byte
+		switch op {
+		case 'x', 'X':
+			result = bit ^ p
+		case 'a', 'A':
+			result = bit & p
+		case 'o', 'O':
+			result = bit | p
+		}
+		if strings.ContainsRune("XAO", op) {
+			result ^= 1
+		}
+		out = append(out, result)
+	}
+	return out
+}
+
+// TestLogicalOpFastPath compares the byte-at-a-time path (pattern lengths dividing
+// 8, byte-aligned start) and the bit-by-bit fallback with the naive loop.
+func TestLogicalOpFastPath(t *testing.T) {
+	data := []byte{0xB1, 0x0F, 0x5A, 0xC3, 0x96}
+	inputBits := bitio.BytesToBits(data)
+	patterns := []string{"1", "01", "0110", "10010110", "101"}
+	ranges := [][2]int{{0, 40}, {8, 37}, {3, 40}, {16, 20}}
+	for _, op := range "xaoXAO" {
+		for _, pattern := range patterns {
+			for _, r := range ranges {
+				var out bytes.Buffer
+				applyLogicalOp(&out, data, inputBits, r[0], r[1], op, pattern)
+				want := naiveLogicalOp(inputBits, r[0], r[1], op, pattern)
+				if !bytes.Equal(out.Bytes(), want) {
+					t.Errorf("%c with pattern %s over bits %d-%d = %v, want %v", op, pattern, r[0], r[1], out.Bytes(), want)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkLogicalOp(b *testing.B) {
+	data := bytes.Repeat([]byte{0xB1, 0x0F}, 1<<15)
+	inputBits := bitio.BytesToBits(data)
+	for _, pattern := range []string{"01", "101"} {
+		b.Run("pattern"+pattern, func(b *testing.B) {
+			var out bytes.Buffer
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				out.Reset()
+				applyLogicalOp(&out, data, inputBits, 0, len(inputBits), 'x', pattern)
+			}
+		})
+	}
+}
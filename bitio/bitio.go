@@ -0,0 +1,240 @@
+// Package bitio reads and writes streams of single bits on top of an io.Reader or
+// io.Writer. It is shared by the tools in this repository, which all pack bits most
+// significant first by default.
+//
+// Bits are passed around either as one bit per byte (Read and Write, holding 0 or
+// 1) or as the low bits of an integer (ReadBits and WriteBits). BytesToBits and
+// BitsToBytes convert whole buffers between the two forms without a stream.
+package bitio
+
+import (
+	"bufio"
+	"io"
+)
+
+// Order is the order in which the bits of each byte are read or written.
+type Order int
+
+const (
+	// MSBFirst takes the most significant bit of each byte first.
+	MSBFirst Order = iota
+	// LSBFirst takes the least significant bit of each byte first.
+	LSBFirst
+)
+
+// shift returns the position in a byte of the bit at index i (0-7) in stream order.
+func (o Order) shift(i int) uint {
+	if o == LSBFirst {
+		return uint(i)
+	}
+	return uint(7 - i)
+}
+
+// --- Reader ---
+
+// Reader reads bits from an io.Reader one byte at a time. Wrap the source in a
+// bufio.Reader when it is a file or network connection.
+type Reader struct {
+	reader io.Reader
+	order  Order
+	buffer [1]byte
+	offset int // 0-8, number of bits already read from the buffer
+}
+
+// NewReader returns a Reader that takes the most significant bit of each byte first.
+func NewReader(r io.Reader) *Reader {
+	return NewReaderOrder(r, MSBFirst)
+}
+
+// NewReaderOrder returns a Reader with the given bit order.
+func NewReaderOrder(r io.Reader, order Order) *Reader {
+	return &Reader{reader: r, order: order, offset: 8}
+}
+
+// readBit returns the next bit.
+func (br *Reader) readBit() (byte, error) {
+	if br.offset == 8 {
+		// io.ReadFull retries short reads; a bare Read may legally return
+		// no data and no error, which would leave the buffer holding a stale byte.
+		if _, err := io.ReadFull(br.reader, br.buffer[:]); err != nil {
+			return 0, err
+		}
+		br.offset = 0
+	}
+	bit := br.buffer[0] >> br.order.shift(br.offset) & 1
+	br.offset++
+	return bit, nil
+}
+
+// Read returns the next n bits, one per byte. If the input ends first it returns
+// the bits read so far with io.EOF, so a caller can use a short final group.
+func (br *Reader) Read(n int) ([]byte, error) {
+	bits := make([]byte, n)
+	for i := range bits {
+		bit, err := br.readBit()
+		if err != nil {
+			return bits[:i], err
+		}
+		bits[i] = bit
+	}
+	return bits, nil
+}
+
+// ReadBits returns the next n bits (at most 64) as an integer, the first bit read
+// being the most significant with MSBFirst and the least significant with LSBFirst.
+// Like io.ReadFull it returns io.EOF if no bits were left and io.ErrUnexpectedEOF
+// if fewer than n were.
+func (br *Reader) ReadBits(n int) (uint64, error) {
+	var value uint64
+	for i := 0; i < n; i++ {
+		bit, err := br.readBit()
+		if err == io.EOF && i > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return value, err
+		}
+		if br.order == LSBFirst {
+			value |= uint64(bit) << uint(i)
+		} else {
+			value = value<<1 | uint64(bit)
+		}
+	}
+	return value, nil
+}
+
+// --- Writer ---
+
+// Writer packs bits into bytes and writes them through a bufio.Writer. Close must
+// be called to write the final partial byte.
+type Writer struct {
+	writer  *bufio.Writer
+	order   Order
+	buffer  byte
+	offset  int   // 0-7, number of bits written to the buffer
+	written int64 // total bits written, before padding of the final byte
+}
+
+// NewWriter returns a Writer that fills the most significant bit of each byte first.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterOrder(w, MSBFirst)
+}
+
+// NewWriterOrder returns a Writer with the given bit order.
+func NewWriterOrder(w io.Writer, order Order) *Writer {
+	return &Writer{writer: bufio.NewWriter(w), order: order}
+}
+
+// writeBit appends one bit, writing out the byte once it is full.
+func (bw *Writer) writeBit(bit byte) error {
+	bw.buffer |= (bit & 1) << bw.order.shift(bw.offset)
+	bw.offset++
+	bw.written++
+	if bw.offset == 8 {
+		return bw.flushByte()
+	}
+	return nil
+}
+
+// Write writes bits given one per byte. Only the low bit of each byte is used.
+func (bw *Writer) Write(bits []byte) error {
+	for _, bit := range bits {
+		if err := bw.writeBit(bit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBits writes the low n bits of value (at most 64), in the order ReadBits
+// returns them: most significant first with MSBFirst, least significant first
+// with LSBFirst.
+func (bw *Writer) WriteBits(value uint64, n int) error {
+	for i := 0; i < n; i++ {
+		shift := uint(n - 1 - i)
+		if bw.order == LSBFirst {
+			shift = uint(i)
+		}
+		if err := bw.writeBit(byte(value >> shift)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteByte writes the eight bits of b in the writer's bit order. When the writer is
+// byte-aligned the byte goes straight to the underlying writer unchanged.
+func (bw *Writer) WriteByte(b byte) error {
+	if bw.offset != 0 {
+		return bw.WriteBits(uint64(b), 8)
+	}
+	bw.written += 8
+	return bw.writer.WriteByte(b)
+}
+
+// Written returns the number of bits written, not counting the padding Close adds.
+func (bw *Writer) Written() int64 {
+	return bw.written
+}
+
+func (bw *Writer) flushByte() error {
+	if bw.offset == 0 {
+		return nil
+	}
+	err := bw.writer.WriteByte(bw.buffer)
+	bw.buffer = 0
+	bw.offset = 0
+	return err
+}
+
+// Flush writes the completed bytes to the underlying writer. A partial final byte
+// is kept back so more bits can follow.
+func (bw *Writer) Flush() error {
+	return bw.writer.Flush()
+}
+
+// Close pads a partial final byte with zero bits and flushes. It does not close the
+// underlying writer.
+func (bw *Writer) Close() error {
+	if err := bw.flushByte(); err != nil {
+		return err
+	}
+	return bw.writer.Flush()
+}
+
+// --- Whole Buffers ---
+
+// byteBits maps each byte value to its 8 bits, most significant first.
+var byteBits = func() (table [256][8]byte) {
+	for b := range table {
+		for j := 0; j < 8; j++ {
+			table[b][j] = byte(b>>(7-j)) & 1
+		}
+	}
+	return table
+}()
+
+// BytesToBits expands data to one bit per byte, most significant bit first.
+func BytesToBits(data []byte) []byte {
+	bits := make([]byte, len(data)*8)
+	for i, b := range data {
+		copy(bits[i*8:i*8+8], byteBits[b][:])
+	}
+	return bits
+}
+
+// BitsToBytes packs one bit per byte into bytes, most significant bit first,
+// padding a partial final byte with zero bits.
+func BitsToBytes(bits []byte) []byte {
+	byteCount := (len(bits) + 7) / 8
+	data := make([]byte, byteCount)
+	full := len(bits) / 8
+	for i := 0; i < full; i++ {
+		b := bits[i*8 : i*8+8]
+		data[i] = b[0]<<7 | b[1]<<6 | b[2]<<5 | b[3]<<4 | b[4]<<3 | b[5]<<2 | b[6]<<1 | b[7]
+	}
+	for i := full * 8; i < len(bits); i++ {
+		data[full] |= bits[i] << (7 - uint(i%8))
+	}
+	return data
+}
@@ -0,0 +1,232 @@
+package bitio
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// input is 10110001 00001111.
+var input = []byte{0xB1, 0x0F}
+
+func TestReaderOrder(t *testing.T) {
+	tests := []struct {
+		order Order
+		want  string
+	}{
+		{MSBFirst, "1011000100001111"},
+		{LSBFirst, "1000110111110000"},
+	}
+	for _, tt := range tests {
+		// OneByteReader and DataErrReader make sure short reads are retried
+		br := NewReaderOrder(iotest.DataErrReader(iotest.OneByteReader(bytes.NewReader(input))), tt.order)
+		bits, err := br.Read(16)
+		if err != nil {
+			t.Fatalf("order %d: Read: %v", tt.order, err)
+		}
+		if got := string(bitsToText(bits)); got != tt.want {
+			t.Errorf("order %d: Read = %s, want %s", tt.order, got, tt.want)
+		}
+	}
+}
+
+// stallingReader returns no data and no error on every other call, which io.Reader
+// allows, and at most one byte otherwise.
+type stallingReader struct {
+	r     io.Reader
+	stall bool
+}
+
+func (s *stallingReader) Read(p []byte) (int, error) {
+	s.stall = !s.stall
+	if s.stall || len(p) == 0 {
+		return 0, nil
+	}
+	return s.r.Read(p[:1])
+}
+
+// TestReaderShortReads checks that a read returning nothing is retried rather than
+// leaving the previous byte in the buffer.
+func TestReaderShortReads(t *testing.T) {
+	data := []byte{0xB1, 0x0F, 0x5A}
+	br := NewReader(&stallingReader{r: bytes.NewReader(data)})
+	bits, err := br.Read(32)
+	if err != io.EOF || !bytes.Equal(BitsToBytes(bits), data) {
+		t.Errorf("Read = %x, %v; want %x, io.EOF", BitsToBytes(bits), err, data)
+	}
+}
+
+func TestReaderEOF(t *testing.T) {
+	br := NewReader(bytes.NewReader(input))
+	bits, err := br.Read(20)
+	if err != io.EOF || len(bits) != 16 {
+		t.Errorf("Read past the end = %d bits, %v; want 16 bits, io.EOF", len(bits), err)
+	}
+
+	br = NewReader(bytes.NewReader(input))
+	if v, err := br.ReadBits(12); err != nil || v != 0xB10 {
+		t.Errorf("ReadBits(12) = 0x%x, %v; want 0xb10", v, err)
+	}
+	if _, err := br.ReadBits(8); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadBits past the end: %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := br.ReadBits(1); err != io.EOF {
+		t.Errorf("ReadBits at the end: %v, want io.EOF", err)
+	}
+
+	br = NewReaderOrder(bytes.NewReader(input), LSBFirst)
+	if v, err := br.ReadBits(12); err != nil || v != 0xFB1 {
+		t.Errorf("LSBFirst ReadBits(12) = 0x%x, %v; want 0xfb1", v, err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		order Order
+		want  string
+	}{
+		{MSBFirst, "b10fa0"},
+		{LSBFirst, "fd1005"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		bw := NewWriterOrder(&out, tt.order)
+		bw.Write([]byte{1, 0, 1, 1})
+		bw.WriteBits(0x10F, 12)
+		bw.WriteBits(0x5, 3)
+		if bw.Written() != 19 {
+			t.Errorf("order %d: Written = %d, want 19", tt.order, bw.Written())
+		}
+		if err := bw.Flush(); err != nil || out.Len() != 2 {
+			t.Errorf("order %d: Flush wrote %d bytes, %v; want 2", tt.order, out.Len(), err)
+		}
+		if err := bw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(out.Bytes()); got != tt.want {
+			t.Errorf("order %d: wrote %s, want %s", tt.order, got, tt.want)
+		}
+
+		// Reading back with the same order returns the same bits and values
+		br := NewReaderOrder(bytes.NewReader(out.Bytes()), tt.order)
+		first, _ := br.Read(4)
+		second, _ := br.ReadBits(12)
+		third, _ := br.ReadBits(3)
+		if !bytes.Equal(first, []byte{1, 0, 1, 1}) || second != 0x10F || third != 0x5 {
+			t.Errorf("order %d: read back %v %x %x", tt.order, first, second, third)
+		}
+	}
+}
+
+func TestWriteByte(t *testing.T) {
+	for _, order := range []Order{MSBFirst, LSBFirst} {
+		var out bytes.Buffer
+		bw := NewWriterOrder(&out, order)
+		bw.WriteByte(0xB1) // aligned: stored unchanged
+		bw.WriteBits(0, 4)
+		bw.WriteByte(0x0F) // unaligned: split over two bytes
+		bw.Close()
+
+		br := NewReaderOrder(bytes.NewReader(out.Bytes()), order)
+		first, _ := br.ReadBits(8)
+		br.ReadBits(4)
+		second, _ := br.ReadBits(8)
+		if out.Bytes()[0] != 0xB1 || first != 0xB1 || second != 0x0F {
+			t.Errorf("order %d: wrote %x, read back %x %x", order, out.Bytes(), first, second)
+		}
+	}
+}
+
+func TestBytesToBits(t *testing.T) {
+	bits := BytesToBits(input)
+	if got := string(bitsToText(bits)); got != "1011000100001111" {
+		t.Errorf("BytesToBits = %s", got)
+	}
+	if got := BitsToBytes(bits[:13]); !bytes.Equal(got, []byte{0xB1, 0x08}) {
+		t.Errorf("BitsToBytes of 13 bits = %x, want b108", got)
+	}
+}
+
+// naiveBytesToBits and naiveBitsToBytes are the per-bit loops the lookup table and
+// whole-byte packing replaced.
+func naiveBytesToBits(data []byte) []byte {
+	bits := make([]byte, len(data)*8)
+	for i, b := range data {
+		for j := 0; j < 8; j++ {
+			bits[i*8+j] = (b >> uint(7-j)) & 1
+		}
+	}
+	return bits
+}
+
+func naiveBitsToBytes(bits []byte) []byte {
+	data := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		data[i/8] |= bit << uint(7-i%8)
+	}
+	return data
+}
+
+func TestBytesToBitsMatchesNaive(t *testing.T) {
+	all := make([]byte, 256)
+	for b := range all {
+		all[b] = byte(b)
+		got, want := BytesToBits(all[b:b+1]), naiveBytesToBits(all[b:b+1])
+		if !bytes.Equal(got, want) {
+			t.Errorf("BytesToBits(%02x) = %v, want %v", b, got, want)
+		}
+		if packed := BitsToBytes(want); !bytes.Equal(packed, all[b:b+1]) {
+			t.Errorf("BitsToBytes(%v) = %x, want %02x", want, packed, b)
+		}
+	}
+
+	// Every length, so the partial final byte is packed the same way too
+	bits := naiveBytesToBits(all)
+	for n := 0; n <= len(bits); n++ {
+		if got, want := BitsToBytes(bits[:n]), naiveBitsToBytes(bits[:n]); !bytes.Equal(got, want) {
+			t.Fatalf("BitsToBytes of %d bits = %x, want %x", n, got, want)
+		}
+	}
+}
+
+var benchData = bytes.Repeat([]byte{0xB1, 0x0F, 0x5A, 0xC3}, 1<<14)
+
+func BenchmarkBytesToBits(b *testing.B) {
+	b.SetBytes(int64(len(benchData)))
+	for i := 0; i < b.N; i++ {
+		BytesToBits(benchData)
+	}
+}
+
+func BenchmarkBytesToBitsNaive(b *testing.B) {
+	b.SetBytes(int64(len(benchData)))
+	for i := 0; i < b.N; i++ {
+		naiveBytesToBits(benchData)
+	}
+}
+
+func BenchmarkBitsToBytes(b *testing.B) {
+	bits := BytesToBits(benchData)
+	b.SetBytes(int64(len(benchData)))
+	for i := 0; i < b.N; i++ {
+		BitsToBytes(bits)
+	}
+}
+
+func BenchmarkBitsToBytesNaive(b *testing.B) {
+	bits := BytesToBits(benchData)
+	b.SetBytes(int64(len(benchData)))
+	for i := 0; i < b.N; i++ {
+		naiveBitsToBytes(bits)
+	}
+}
+
+func bitsToText(bits []byte) []byte {
+	text := make([]byte, len(bits))
+	for i, bit := range bits {
+		text[i] = '0' + bit
+	}
+	return text
+}
@@ -0,0 +1,902 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/PaulW-NZ/Bit-tools/bitedit"
+	"github.com/PaulW-NZ/Bit-tools/bitio"
+	"github.com/PaulW-NZ/Bit-tools/internal/outfile"
+)
+
+func printHelp() {
+	fmt.Println(`Bit Editor - A command-line tool for bit-level file manipulation.`)
+	fmt.Println()
+	fmt.Println("USAGE:")
+	fmt.Println("  ./bit-editor -e \"<commands>\" [-i <in_file>] [-o <out_file>] [--start <bit>] [--end <bit>]")
+	fmt.Println("  cat <in_file> | ./bit-editor -e \"<commands>\" > <out_file>")
+	fmt.Println()
+	fmt.Println("FLAGS:")
+	fmt.Println("  -e string")
+	fmt.Println("    \t(Required) The repeating string of edit commands.")
+	fmt.Println("  -e-file string")
+	fmt.Println("    \tRead the edit command string from a file. '#' starts a comment to the end of the line, and")
+	fmt.Println("    \twhitespace between commands is ignored (in -e too).")
+	fmt.Println("  -i string")
+	fmt.Println("    \tInput file path. Defaults to standard input.")
+	fmt.Println("  -o string")
+	fmt.Println("    \tOutput file path. Defaults to standard output.")
+	fmt.Println("  --start int")
+	fmt.Println("    \tThe bit position to start editing from (inclusive). Defaults to 0.")
+	fmt.Println("  --end int")
+	fmt.Println("    \tThe bit position to stop editing at (exclusive). Defaults to the end of the data.")
+	fmt.Println("  --start-byte int, --end-byte int")
+	fmt.Println("    \tThe same range given in bytes (converted to bits by multiplying by 8). Cannot be used with --start/--end.")
+	fmt.Println("  --verbose")
+	fmt.Println("    \tEnable verbose logging for every loop of the command sequence.")
+	fmt.Println("  --verbose-once")
+	fmt.Println("    \tEnable verbose logging for the first command sequence loop only.")
+	fmt.Println("  --hamming-distance string")
+	fmt.Println("    \tPrint the number of differing bits between the input and a reference file of the same length")
+	fmt.Println("    \twithin --start/--end, then exit. With --verbose, also print the distance of each differing byte.")
+	fmt.Println("  --to-ascii-bits")
+	fmt.Println("    \tWrite each output byte as 8 ASCII '0'/'1' characters.")
+	fmt.Println("  --format string")
+	fmt.Println("    \tOutput format: raw (default), bin (ASCII '0'/'1' per bit, including partial trailing bits)")
+	fmt.Println("    \tor hex (two lowercase hex characters per byte).")
+	fmt.Println("  --from-ascii-bits")
+	fmt.Println("    \tParse the input as ASCII '0'/'1' characters (8 per byte, whitespace ignored) before editing.")
+	fmt.Println("    \tWith either flag or --format, -e may be omitted to convert the data unchanged.")
+	fmt.Println("  --show-config")
+	fmt.Println("    \tPrint the resolved configuration to stderr before processing.")
+	fmt.Println("  --stats")
+	fmt.Println("    \tPrint bit statistics of the output (total, ones, zeros, longest runs, ones ratio) instead of writing it.")
+	fmt.Println("  --dump-bits")
+	fmt.Println("    \tPrint the input range (and the output, if -e is given) as 0/1 strings to stderr.")
+	fmt.Println("  --dry-run")
+	fmt.Println("    \tSimulate operations and report the output size and its CRC-32 without writing data.")
+	fmt.Println("  --repeat int")
+	fmt.Println("    \tRun the command string at most this many times instead of until the end of the range.")
+	fmt.Println("  --tail copy|drop")
+	fmt.Println("    \tWith --repeat, copy the input left over after the last pass to the output, or drop it. Defaults to copy.")
+	fmt.Println("  --splice")
+	fmt.Println("    \tCopy the bits before --start and after --end through unchanged around the edited range.")
+	fmt.Println("  --strict-bounds")
+	fmt.Println("    \tError when a length-prefixed take runs past the end of the range instead of clamping.")
+	fmt.Println("  --frame-sync <binary>:<interval>")
+	fmt.Println("    \tInsert the sync word before every <interval> payload bits of output (inserted syncs are not counted).")
+	fmt.Println("  --self-xor-delay int")
+	fmt.Println("    \tReplace each edited output bit i with bit i XOR bit i-D (bits before the range count as 0).")
+	fmt.Println("  --self-xor-inverse")
+	fmt.Println("    \tUndo --self-xor-delay: bit i becomes bit i XOR reconstructed bit i-D.")
+	fmt.Println("  --bit-reverse-reorder int")
+	fmt.Println("    \tReorder the edited output in blocks of N words (N a power of two) by bit-reversed word index.")
+	fmt.Println("  --word-size int")
+	fmt.Println("    \tWord width in bits for --bit-reverse-reorder. Defaults to 8.")
+	fmt.Println("  --checksum int")
+	fmt.Println("    \tAppend an additive checksum (sum of output bytes mod 2^8 or 2^16) of width 8 or 16.")
+	fmt.Println("  --no-clobber")
+	fmt.Println("    \tRefuse to overwrite an existing output file.")
+	fmt.Println("  --force")
+	fmt.Println("    \tAllow overwriting existing output files, overriding --no-clobber.")
+	fmt.Println("  --help")
+	fmt.Println("    \tShow this detailed help message.")
+	fmt.Println()
+	fmt.Println("COMMANDS:")
+	fmt.Println("  --- Stream Operations ---")
+	fmt.Println("  t<number>    Take <number> bits from the input stream.")
+	fmt.Println("  s<number>    Skip <number> bits from the input stream.")
+	fmt.Println("  i<binary>    Insert a literal <binary> string into the output.")
+	fmt.Println("  n<number>    Invert the next <number> bits from the input stream.")
+	fmt.Println("  z<number>    Consume the next <number> bits and write that many 0 bits (like a<number>:0).")
+	fmt.Println("  Z<number>    Consume the next <number> bits and write that many 1 bits (like o<number>:1).")
+	fmt.Println("  d<N>:<K>     Read the next <N> bits and write them <K> times (copies live input, unlike i).")
+	fmt.Println("  p<bit>       Write fill bits of value <bit> (0 or 1) until the output is a whole number of bytes.")
+	fmt.Println("  P<number>    Write 0 bits until the output length is a multiple of <number> bits.")
+	fmt.Println("  l<width>t    Read a <width>-bit big-endian length L from the input, then take L bits.")
+	fmt.Println("               The length field itself is not written to the output.")
+	fmt.Println()
+	fmt.Println("  --- Re-ordering Operations ---")
+	fmt.Println("  v<number>    Reverse the order of BITS within the next <number>-bit word.")
+	fmt.Println("  b<number>    Reverse the order of BYTES within the next <number>-bit word (for endian swapping).")
+	fmt.Println("  V            Reverse all the remaining bits up to --end as one word. Takes no number, and consumes")
+	fmt.Println("               the rest of the range, so a program \"V\" reverses the whole range.")
+	fmt.Println("  l<N>:<K>     Rotate the next <N>-bit word left by <K> bits (K is taken modulo N).")
+	fmt.Println("  r<N>:<K>     Rotate the next <N>-bit word right by <K> bits. A short final word rotates within")
+	fmt.Println("               its actual length.")
+	fmt.Println("  L<N>:<K>     Shift the next <N>-bit word left by <K> bits, dropping the top bits and filling with zeros.")
+	fmt.Println("  R<N>:<K>     Shift the next <N>-bit word right by <K> bits with zero fill. Each word stays <N> bits")
+	fmt.Println("               long (a short final word keeps its own length).")
+	fmt.Println()
+	fmt.Println("  --- Logical Operations ---")
+	fmt.Println("  x<N>:<P>    XOR the next <N> bits with the repeating pattern <P>.")
+	fmt.Println("  a<N>:<P>    AND the next <N> bits with the repeating pattern <P>.")
+	fmt.Println("  o<N>:<P>    OR the next <N> bits with the repeating pattern <P>.")
+	fmt.Println("  I<N>:<M>    Invert the next <N> bits where the repeating mask <M> has a 1. This is the")
+	fmt.Println("              same operation as x<N>:<M>, named for selective inversion.")
+	fmt.Println("  X<N>:<P>    XNOR the next <N> bits with the repeating pattern <P>.")
+	fmt.Println("  A<N>:<P>    NAND the next <N> bits with the repeating pattern <P>.")
+	fmt.Println("  O<N>:<P>    NOR the next <N> bits with the repeating pattern <P>.")
+	fmt.Println("  Patterns may also be given in hex with a 0x prefix (e.g., x32:0xdeadbeef), four bits per digit.")
+	fmt.Println("  Hex digits include command letters, so a hex pattern runs to the next ';' or the end of the string")
+	fmt.Println("  (e.g., x32:0xdeadbeef;b8). A binary 0 followed by an x command, as in a8:0x8:1, is still binary.")
+	fmt.Println("  A pattern of @<path> is read from a file (8 bits per byte); the path runs to the next ';' or the")
+	fmt.Println("  end of the string, and a count of 0 applies it over the rest of the range (e.g., x0:@mask.bin).")
+	fmt.Println()
+	fmt.Println("  --- Gray Code ---")
+	fmt.Println("  G<number>    Convert the next <number>-bit word from binary to Gray code.")
+	fmt.Println("  B<number>    Convert the next <number>-bit word from Gray code back to binary.")
+	fmt.Println("  (Not g/G: g<number> is the PCM sign flip, so these are G for to-Gray and B for to-binary.)")
+	fmt.Println("               A short final word is converted at its actual length. For example, with 4-bit")
+	fmt.Println("               words G4 turns 0111 (7) into 0100, and B4 turns 0100 back into 0111.")
+	fmt.Println()
+	fmt.Println("  --- Differential Coding ---")
+	fmt.Println("  D<number>    Differentially encode the next <number> bits (out = in XOR previous out).")
+	fmt.Println("  F<number>    Differentially decode the next <number> bits (out = in XOR previous in).")
+	fmt.Println("               The previous bit starts at 0 and carries over across the whole stream.")
+	fmt.Println()
+	fmt.Println("  --- PCM Samples ---")
+	fmt.Println("  g<number>    Negate each sample in the next <number> bits (a multiple of --sample-width).")
+	fmt.Println("               Samples are set by --sample-width (default 16), --sample-format signed|unsigned")
+	fmt.Println("               and --sample-endian big|little. The most negative sample saturates to the largest.")
+	fmt.Println()
+	fmt.Println("  --- Debugging ---")
+	fmt.Println("  *            Write the output so far to the --tee file. Each marker overwrites the file,")
+	fmt.Println("               or appends to it with --tee-append. Without --tee, markers are ignored.")
+	fmt.Println()
+	fmt.Println("  --- Block Operations ---")
+	fmt.Println("  [<chain>]<N>  Processes the next <N> bits as a single block, applying the <chain> of commands to it.")
+	fmt.Println("               - Allowed commands in a chain: n, v, b, x, a, o, I, X, A, O, l, r, L, R, d, G, B.")
+	fmt.Println("               - Rotates, shifts and d in a chain give only the amount and apply to the whole block")
+	fmt.Println("                 (e.g., [l:3]8, or [d:2]8 to write each byte twice).")
+	fmt.Println("               - Commands inside a block apply to the whole block (e.g., 'n' inverts all N bits).")
+	fmt.Println("               - Logical ops in a chain still require a pattern (e.g., [nx:101]8).")
+	fmt.Println("  [<chain>]<N>!<W>  As above, then append a W-bit CRC (8, 16 or 32) of the processed block.")
+	fmt.Println("               - CRC-8/DARC, CRC-16/MODBUS and CRC-32 are used, matching the crc tool.")
+	fmt.Println("               - A block that is not a whole number of bytes is zero-padded for the CRC only.")
+	fmt.Println("  --verify-crc <W>  Check the last W bits of the edited output as a CRC of the bits before them")
+	fmt.Println("               and strip them, or fail on a mismatch. Uses the same CRCs as the block trailer.")
+	fmt.Println()
+	fmt.Println("  --- Splitting Output ---")
+	fmt.Println("  --split-blocks <dir>  Write each block's output to <dir>/block_0000.bin, block_0001.bin, ...")
+	fmt.Println("               - A file ends after every [<chain>]<N> block and after every pass of the command string.")
+	fmt.Println("               - A short final block gets its own, shorter file; partial bytes are zero-padded.")
+	fmt.Println()
+	fmt.Println("EXAMPLES:")
+	fmt.Println("  1. Extract 1 byte from every 3 bytes:")
+	fmt.Println("     ./bit-editor -e \"s16t8\" -i in.dat -o out.dat")
+	fmt.Println()
+	fmt.Println("  2. Change endianness of a file with 32-bit (4-byte) words:")
+	fmt.Println("     ./bit-editor -e \"b32\" -i in.dat -o out.dat")
+	fmt.Println()
+	fmt.Println("  3. Reverse and Invert each byte of a file (with verbose logging):")
+	fmt.Println("     ./bit-editor -e \"[vn]8\" --verbose -i in.dat -o out.dat")
+	fmt.Println()
+	fmt.Println("  4. Check the output size of a complex operation without writing the file:")
+	fmt.Println("     ./bit-editor -e \"[a:11110000]16[b]16\" --dry-run -i in.dat")
+}
+
+func main() {
+	// 1. Define and parse command-line flags
+	detailedHelp := flag.Bool("help", false, "Show detailed help text and examples.")
+	verbose := flag.Bool("verbose", false, "Enable verbose logging for every loop of the command sequence.")
+	verboseOnce := flag.Bool("verbose-once", false, "Enable verbose logging for the first command sequence loop only.")
+	dryRun := flag.Bool("dry-run", false, "Simulate operations and report output size without writing data.")
+	distanceFile := flag.String("hamming-distance", "", "Print the Hamming distance between the input and this reference file, then exit.")
+	toASCIIBits := flag.Bool("to-ascii-bits", false, "Write each output byte as 8 ASCII '0'/'1' characters.")
+	outputFormat := flag.String("format", "raw", "Output format: raw, bin (ASCII '0'/'1' per bit) or hex.")
+	fromASCIIBits := flag.Bool("from-ascii-bits", false, "Parse the input as ASCII '0'/'1' characters before editing.")
+	showConfig := flag.Bool("show-config", false, "Print the resolved configuration to stderr before processing.")
+	stats := flag.Bool("stats", false, "Print bit statistics of the output to stdout instead of writing it.")
+	dumpBits := flag.Bool("dump-bits", false, "Print the input range and output as bit strings to stderr.")
+	var inputFiles stringList
+	flag.Var(&inputFiles, "i", "Input file path. Defaults to stdin. Repeat to run the program over several files (with --out-template).")
+	outputFile := flag.String("o", "", "Output file path. Defaults to stdout.")
+	outTemplate := flag.String("out-template", "", "Output path for each -i input, with {base} (input path without extension) and {ext} (extension) placeholders.")
+	keepGoing := flag.Bool("keep-going", false, "With several inputs, continue with the remaining files after one fails.")
+	editString := flag.String("e", "", "Edit command string (e.g., 's16t8'). Required.")
+	teePath := flag.String("tee", "", "Write the output so far to this file at each '*' marker in the edit string.")
+	teeAppend := flag.Bool("tee-append", false, "Append a snapshot to the --tee file at each marker instead of overwriting it.")
+	editFile := flag.String("e-file", "", "Read the edit command string from this file.")
+	editStdin := flag.Bool("edit-stdin", false, "Read the edit command string from stdin; the data must then come from -i <file>.")
+	validateOnly := flag.Bool("validate-only", false, "Check the edit command string for syntax errors and exit without reading input.")
+	startBit := flag.Int("start", 0, "Start bit for editing (inclusive).")
+	endBit := flag.Int("end", 0, "End bit for editing (exclusive). Defaults to the end of the data.")
+	startByte := flag.Int("start-byte", -1, "Start byte for editing (inclusive); an alternative to --start.")
+	endByte := flag.Int("end-byte", -1, "End byte for editing (exclusive); an alternative to --end.")
+	splice := flag.Bool("splice", false, "Copy bits outside the --start/--end range through unchanged.")
+	repeat := flag.Int("repeat", 0, "Run the command string at most this many times (0 repeats until the end of the range).")
+	tailMode := flag.String("tail", "copy", "With --repeat, copy or drop the input left after the last pass.")
+	reverseRange := flag.Bool("reverse-range", false, "Reverse the order of the edited output bits; with --splice the surrounding bits stay in place.")
+	strictBounds := flag.Bool("strict-bounds", false, "Error instead of clamping when a length-prefixed take exceeds the range.")
+	frameSyncStr := flag.String("frame-sync", "", "Insert a sync word before every <interval> output bits, as <binary>:<interval>.")
+	xorDelay := flag.Int("self-xor-delay", 0, "XOR each edited output bit with the bit D positions earlier.")
+	xorInverse := flag.Bool("self-xor-inverse", false, "Undo --self-xor-delay with a cumulative reconstruction.")
+	reorderWords := flag.Int("bit-reverse-reorder", 0, "Reorder the edited output in blocks of N words by bit-reversed index (N a power of two).")
+	reorderWidth := flag.Int("word-size", 8, "Word width in bits for --bit-reverse-reorder.")
+	sampleWidth := flag.Int("sample-width", 16, "PCM sample width in bits for the 'g' (flip sign) command.")
+	sampleFormat := flag.String("sample-format", "signed", "PCM sample format for the 'g' command: signed or unsigned.")
+	sampleEndian := flag.String("sample-endian", "big", "PCM sample byte order for the 'g' command: big or little.")
+	exactBits := flag.Bool("output-bits-exact", false, "Record the exact number of output bits in <output>.bits (or on stderr for stdout).")
+	splitDir := flag.String("split-blocks", "", "Write the output of each block (or each pass of the command string) to a numbered file in this directory.")
+	verifyCRC := flag.Int("verify-crc", 0, "Check the last <width> (8, 16 or 32) bits of the edited output as a CRC of the bits before them, then strip them.")
+	checksumWidth := flag.Int("checksum", 0, "Append an additive checksum of the given width (8 or 16) to the output.")
+	noClobberFlag := flag.Bool("no-clobber", false, "Refuse to overwrite existing output files.")
+	force := flag.Bool("force", false, "Allow overwriting existing output files, overriding --no-clobber.")
+	flag.Parse()
+	outfile.NoClobber = *noClobberFlag && !*force
+
+	if *detailedHelp {
+		printHelp()
+		os.Exit(0)
+	}
+
+	// With --edit-stdin the data cannot come from stdin as well
+	dataFromStdin := !*validateOnly && (len(inputFiles) == 0 || inputFiles[0] == "-")
+	text, err := loadProgram(*editString, *editFile, *editStdin, dataFromStdin, os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	*editString = text
+
+	// Comments and the whitespace between commands are dropped before anything parses the program
+	program := bitedit.Parse(*editString)
+	*editString = program.Commands()
+	if (*editFile != "" || *editStdin) && *editString == "" {
+		fmt.Fprintln(os.Stderr, "Error: the edit program contains no commands.")
+		os.Exit(1)
+	}
+
+	if *outputFormat != "raw" && *outputFormat != "bin" && *outputFormat != "hex" {
+		fmt.Fprintf(os.Stderr, "Error: --format must be raw, bin or hex, got %q.\n", *outputFormat)
+		os.Exit(1)
+	}
+	if *outputFormat != "raw" && (*toASCIIBits || *splitDir != "") {
+		fmt.Fprintln(os.Stderr, "Error: --format cannot be combined with --to-ascii-bits or --split-blocks.")
+		os.Exit(1)
+	}
+
+	asciiConvert := *toASCIIBits || *fromASCIIBits || *outputFormat != "raw"
+	if *stats && (*outputFile != "" || *outTemplate != "" || *splitDir != "" || *dryRun || *toASCIIBits || *outputFormat != "raw") {
+		fmt.Fprintln(os.Stderr, "Error: --stats prints a summary instead of writing output, so it cannot be combined with -o, --out-template, --split-blocks, --dry-run, --format or --to-ascii-bits.")
+		os.Exit(1)
+	}
+
+	if *editString == "" && !*dumpBits && *distanceFile == "" && !asciiConvert && !*stats {
+		fmt.Fprintln(os.Stderr, "Error: -e <editString> is required.")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *checksumWidth != 0 && *checksumWidth != 8 && *checksumWidth != 16 {
+		fmt.Fprintf(os.Stderr, "Error: --checksum must be 8 or 16, got %d.\n", *checksumWidth)
+		os.Exit(1)
+	}
+
+	if *verifyCRC != 0 && *verifyCRC != 8 && *verifyCRC != 16 && *verifyCRC != 32 {
+		fmt.Fprintf(os.Stderr, "Error: --verify-crc must be 8, 16 or 32, got %d.\n", *verifyCRC)
+		os.Exit(1)
+	}
+
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if (setFlags["start-byte"] && setFlags["start"]) || (setFlags["end-byte"] && setFlags["end"]) {
+		fmt.Fprintln(os.Stderr, "Error: --start-byte/--end-byte cannot be combined with the bit-based --start/--end.")
+		os.Exit(1)
+	}
+	if setFlags["start-byte"] {
+		if *startByte < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --start-byte must be >= 0, got %d.\n", *startByte)
+			os.Exit(1)
+		}
+	}
+	if setFlags["end-byte"] {
+		if *endByte <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --end-byte must be > 0, got %d.\n", *endByte)
+			os.Exit(1)
+		}
+	}
+
+	if *repeat < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --repeat must be >= 0, got %d.\n", *repeat)
+		os.Exit(1)
+	}
+	if *tailMode != "copy" && *tailMode != "drop" {
+		fmt.Fprintf(os.Stderr, "Error: --tail must be copy or drop, got %q.\n", *tailMode)
+		os.Exit(1)
+	}
+
+	if *reorderWords != 0 && (*reorderWords < 0 || *reorderWords&(*reorderWords-1) != 0) {
+		fmt.Fprintf(os.Stderr, "Error: --bit-reverse-reorder must be a power of two, got %d.\n", *reorderWords)
+		os.Exit(1)
+	}
+	if *reorderWidth <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --word-size must be > 0, got %d.\n", *reorderWidth)
+		os.Exit(1)
+	}
+
+	if *xorDelay < 0 || (*xorInverse && *xorDelay == 0) {
+		fmt.Fprintln(os.Stderr, "Error: --self-xor-delay must be > 0 (and is required by --self-xor-inverse).")
+		os.Exit(1)
+	}
+
+	if *splitDir != "" && (*editString == "" || *exactBits || *splice || *frameSyncStr != "" || *checksumWidth != 0 || *outputFile != "") {
+		fmt.Fprintln(os.Stderr, "Error: --split-blocks requires -e and cannot be combined with -o, --output-bits-exact, --splice, --frame-sync or --checksum.")
+		os.Exit(1)
+	}
+
+	if *sampleWidth < 2 || *sampleWidth > 64 {
+		fmt.Fprintf(os.Stderr, "Error: --sample-width must be between 2 and 64, got %d.\n", *sampleWidth)
+		os.Exit(1)
+	}
+	if *sampleFormat != "signed" && *sampleFormat != "unsigned" {
+		fmt.Fprintf(os.Stderr, "Error: --sample-format must be signed or unsigned, got %q.\n", *sampleFormat)
+		os.Exit(1)
+	}
+	if *sampleEndian != "big" && *sampleEndian != "little" {
+		fmt.Fprintf(os.Stderr, "Error: --sample-endian must be big or little, got %q.\n", *sampleEndian)
+		os.Exit(1)
+	}
+	if *sampleEndian == "little" && *sampleWidth%8 != 0 {
+		fmt.Fprintf(os.Stderr, "Error: --sample-endian little needs a --sample-width that is a multiple of 8, got %d.\n", *sampleWidth)
+		os.Exit(1)
+	}
+
+	if *validateOnly {
+		if *editString == "" {
+			fmt.Fprintln(os.Stderr, "Error: --validate-only needs a program from -e or --edit-stdin.")
+			os.Exit(1)
+		}
+		problems := program.Check(*sampleWidth)
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", program.Describe(problem))
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "%d problem(s) found in the edit program.\n", len(problems))
+			os.Exit(1)
+		}
+		fmt.Println("Edit program is valid.")
+		os.Exit(0)
+	}
+
+	opts := bitedit.Options{StartBit: *startBit, EndBit: *endBit, VerboseOnce: *verboseOnce,
+		StrictBounds: *strictBounds, Splice: *splice, ReorderWords: *reorderWords, ReorderWidth: *reorderWidth,
+		XorDelay: *xorDelay, XorInverse: *xorInverse, SampleWidth: *sampleWidth,
+		SampleSigned: *sampleFormat == "signed", SampleLittle: *sampleEndian == "little", VerifyCRC: *verifyCRC, ReverseRange: *reverseRange,
+		Repeat: *repeat, TailCopy: *tailMode == "copy"}
+	if *verbose || *verboseOnce {
+		opts.Verbose = os.Stderr
+	}
+	if *teePath != "" {
+		teeFile, err := outfile.Create(*teePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating tee file: %v\n", err)
+			os.Exit(1)
+		}
+		defer teeFile.Close()
+		opts.Tee = func(snapshot []byte) error {
+			return writeTee(teeFile, snapshot, *teeAppend)
+		}
+	}
+	if *frameSyncStr != "" {
+		sync, interval, err := parseFrameSync(*frameSyncStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.FrameSync = sync
+		opts.FrameInterval = interval
+	}
+
+	if len(inputFiles) > 1 || *outTemplate != "" {
+		if *outTemplate == "" || *outputFile != "" {
+			fmt.Fprintln(os.Stderr, "Error: several -i inputs need --out-template instead of -o.")
+			os.Exit(1)
+		}
+		if *distanceFile != "" || *splitDir != "" || *teePath != "" {
+			fmt.Fprintln(os.Stderr, "Error: --out-template cannot be combined with --hamming-distance, --split-blocks or --tee.")
+			os.Exit(1)
+		}
+		for _, path := range inputFiles {
+			if path == "-" {
+				fmt.Fprintln(os.Stderr, "Error: stdin cannot be one of several -i inputs.")
+				os.Exit(1)
+			}
+		}
+	}
+
+	job := &editJob{
+		program:       program,
+		opts:          opts,
+		startByte:     -1,
+		endByte:       -1,
+		fromASCIIBits: *fromASCIIBits,
+		toASCIIBits:   *toASCIIBits,
+		outputFormat:  *outputFormat,
+		showConfig:    *showConfig,
+		frameSync:     *frameSyncStr,
+		checksumWidth: *checksumWidth,
+		distanceFile:  *distanceFile,
+		verbose:       *verbose,
+		dumpBits:      *dumpBits,
+		stats:         *stats,
+		dryRun:        *dryRun,
+		exactBits:     *exactBits,
+		splitDir:      *splitDir,
+		stdin:         os.Stdin,
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
+	}
+	if setFlags["start-byte"] {
+		job.startByte = *startByte
+	}
+	if setFlags["end-byte"] {
+		job.endByte = *endByte
+	}
+
+	if *outTemplate == "" {
+		inputPath := ""
+		if len(inputFiles) == 1 {
+			inputPath = inputFiles[0]
+		}
+		if err := job.processFile(inputPath, *outputFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if job.processFiles(inputFiles, *outTemplate, *keepGoing) > 0 {
+		os.Exit(1)
+	}
+}
+
+// editJob is the pipeline processFile runs for each input, resolved from the flags.
+type editJob struct {
+	program        *bitedit.Program
+	opts           bitedit.Options // StartBit and EndBit hold --start/--end, or the bytes converted
+	startByte      int             // --start-byte, or -1
+	endByte        int             // --end-byte, or -1
+	fromASCIIBits  bool
+	toASCIIBits    bool
+	outputFormat   string
+	showConfig     bool
+	frameSync      string // the --frame-sync argument, for --show-config
+	checksumWidth  int
+	distanceFile   string
+	verbose        bool
+	dumpBits       bool
+	stats          bool
+	dryRun         bool
+	exactBits      bool
+	splitDir       string
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// asciiConvert reports whether the input or output is converted to or from text,
+// which lets the job run without a program.
+func (job *editJob) asciiConvert() bool {
+	return job.toASCIIBits || job.fromASCIIBits || job.outputFormat != "raw"
+}
+
+// processFiles runs the pipeline over several inputs, writing each to the path
+// the template gives for it. Each failure is reported, and stops the run unless
+// keepGoing is set. It returns the number of files that failed.
+func (job *editJob) processFiles(inputFiles []string, template string, keepGoing bool) int {
+	failed := 0
+	for _, inputPath := range inputFiles {
+		outputPath := expandOutTemplate(template, inputPath)
+		if err := job.processFile(inputPath, outputPath); err != nil {
+			fmt.Fprintf(job.stderr, "Error processing %s: %v\n", inputPath, err)
+			failed++
+			if !keepGoing {
+				return failed
+			}
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(job.stderr, "%d of %d files failed.\n", failed, len(inputFiles))
+	}
+	return failed
+}
+
+// processFile runs the whole pipeline for one input and output path.
+func (job *editJob) processFile(inputPath, outputPath string) error {
+	// 2. Set up input reader
+	var reader io.Reader
+	if inputPath == "" || inputPath == "-" {
+		reader = job.stdin
+	} else {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return fmt.Errorf("opening input file: %v", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	// 4. Read input data
+	inputData, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading input: %v", err)
+	}
+
+	if job.fromASCIIBits {
+		inputData, err = fromASCII(inputData)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The byte range is converted to the bit positions the edits take
+	opts := job.opts
+	if job.startByte >= 0 {
+		opts.StartBit = job.startByte * 8
+	}
+	if job.endByte > 0 {
+		opts.EndBit = job.endByte * 8
+	}
+	if job.startByte >= 0 && job.startByte > len(inputData) {
+		return fmt.Errorf("--start-byte %d (bit %d) is out of bounds for %d bytes of input", job.startByte, opts.StartBit, len(inputData))
+	}
+	if job.endByte > 0 && job.endByte > len(inputData) {
+		return fmt.Errorf("--end-byte %d (bit %d) is out of bounds for %d bytes of input", job.endByte, opts.EndBit, len(inputData))
+	}
+	if job.startByte >= 0 && job.endByte > 0 && job.startByte > job.endByte {
+		return fmt.Errorf("--start-byte %d (bit %d) cannot be greater than --end-byte %d (bit %d)", job.startByte, opts.StartBit, job.endByte, opts.EndBit)
+	}
+
+	if job.showConfig {
+		resolvedEnd := opts.EndBit
+		if resolvedEnd <= 0 || resolvedEnd > len(inputData)*8 {
+			resolvedEnd = len(inputData) * 8
+		}
+		fmt.Fprintf(job.stderr, "Config: edit=%q start=%d end=%d splice=%t strict-bounds=%t frame-sync=%q checksum=%d input=%q output=%q\n",
+			job.program.Commands(), opts.StartBit, resolvedEnd, opts.Splice, opts.StrictBounds, job.frameSync, job.checksumWidth, inputPath, outputPath)
+	}
+
+	if job.distanceFile != "" {
+		referenceData, err := os.ReadFile(job.distanceFile)
+		if err != nil {
+			return fmt.Errorf("reading reference file: %v", err)
+		}
+		distance, err := hammingDistance(inputData, referenceData, opts.StartBit, opts.EndBit, job.verbose)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(job.stdout, "Hamming distance: %d bits\n", distance)
+		return nil
+	}
+
+	if job.dumpBits {
+		inputBits := bitio.BytesToBits(inputData)
+		dumpStart, dumpEnd := opts.StartBit, opts.EndBit
+		if dumpEnd <= 0 || dumpEnd > len(inputBits) {
+			dumpEnd = len(inputBits)
+		}
+		if dumpStart < 0 || dumpStart > dumpEnd {
+			return fmt.Errorf("start bit (%d) is out of bounds", dumpStart)
+		}
+		fmt.Fprintf(job.stderr, "Input bits:  %s\n", formatBits(inputBits[dumpStart:dumpEnd]))
+		if job.program.Commands() == "" && !job.asciiConvert() {
+			return nil
+		}
+	}
+
+	// 5. Apply edits
+	outputData := inputData
+	var segments [][]byte
+	if job.splitDir != "" {
+		opts.Segments = &segments
+	}
+	outputBitCount := len(inputData) * 8
+	opts.BitCount = &outputBitCount
+	if job.program.Commands() != "" {
+		outputData, err = job.program.Apply(inputData, opts)
+		if err != nil {
+			if cmdErr, ok := err.(*bitedit.CommandError); ok {
+				return fmt.Errorf("applying edits: %s", job.program.Describe(cmdErr))
+			}
+			return fmt.Errorf("applying edits: %v", err)
+		}
+	}
+
+	if job.checksumWidth != 0 {
+		outputData = appendChecksum(outputData, job.checksumWidth)
+		outputBitCount = len(outputData) * 8
+	}
+
+	if job.dumpBits {
+		fmt.Fprintf(job.stderr, "Output bits: %s\n", formatBits(bitio.BytesToBits(outputData)))
+	}
+
+	if job.stats {
+		statsBits := bitio.BytesToBits(outputData)[:outputBitCount]
+		if job.program.Commands() == "" {
+			// Without a program the range still selects which input bits are counted
+			statsEnd := opts.EndBit
+			if statsEnd <= 0 || statsEnd > len(statsBits) {
+				statsEnd = len(statsBits)
+			}
+			if opts.StartBit < 0 || opts.StartBit > statsEnd {
+				return fmt.Errorf("start bit (%d) is out of bounds", opts.StartBit)
+			}
+			statsBits = statsBits[opts.StartBit:statsEnd]
+		}
+		printStats(job.stdout, statsBits)
+		return nil
+	}
+
+	if job.toASCIIBits {
+		outputData = bitedit.ToASCII(outputData)
+		outputBitCount = len(outputData) * 8
+	}
+	switch job.outputFormat {
+	case "bin":
+		// One character per real output bit, so the padding of a partial last byte is not shown
+		outputData = bitedit.ToASCII(outputData)[:outputBitCount]
+		outputBitCount = len(outputData) * 8
+	case "hex":
+		outputData = []byte(hex.EncodeToString(outputData))
+		outputBitCount = len(outputData) * 8
+	}
+
+	// 6. Write output data or print dry run summary
+	if job.splitDir != "" {
+		if err := writeSegments(job.splitDir, segments, job.toASCIIBits, job.dryRun); err != nil {
+			return fmt.Errorf("writing blocks: %v", err)
+		}
+	} else if job.dryRun {
+		fmt.Fprintf(job.stdout, "Dry run complete. Output would be %d bytes.\n", len(outputData))
+		fmt.Fprintf(job.stdout, "CRC-32: 0x%08x\n", crc32.ChecksumIEEE(outputData))
+	} else {
+		var writer io.Writer
+		if outputPath == "" || outputPath == "-" {
+			writer = job.stdout
+		} else {
+			file, err := outfile.Create(outputPath)
+			if err != nil {
+				return fmt.Errorf("creating output file: %v", err)
+			}
+			defer file.Close()
+			writer = bufio.NewWriter(file)
+			defer writer.(*bufio.Writer).Flush()
+		}
+		_, err = writer.Write(outputData)
+		if err != nil {
+			return fmt.Errorf("writing output: %v", err)
+		}
+		if job.exactBits {
+			if err := outfile.ReportExactBits(outputPath, int64(outputBitCount)); err != nil {
+				return fmt.Errorf("writing bit count: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadProgram returns the edit program from -e, from -e-file, or with --edit-stdin
+// from stdin, which dataFromStdin says the input data would also be read from.
+func loadProgram(editString, editFile string, editStdin, dataFromStdin bool, stdin io.Reader) (string, error) {
+	if editFile != "" {
+		if editString != "" || editStdin {
+			return "", fmt.Errorf("-e-file cannot be combined with -e or --edit-stdin")
+		}
+		text, err := os.ReadFile(editFile)
+		if err != nil {
+			return "", fmt.Errorf("reading edit program file: %v", err)
+		}
+		return string(text), nil
+	}
+	if !editStdin {
+		return editString, nil
+	}
+	if editString != "" {
+		return "", fmt.Errorf("-e and --edit-stdin cannot be used together")
+	}
+	if dataFromStdin {
+		return "", fmt.Errorf("--edit-stdin reads the program from stdin, so -i <file> is required for the data")
+	}
+	text, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("reading edit program from stdin: %v", err)
+	}
+	return string(text), nil
+}
+
+// stringList is a flag.Value collecting every use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// expandOutTemplate fills {base} (the input path without its extension) and {ext}
+// (the extension, including the dot) in template for inputPath.
+func expandOutTemplate(template, inputPath string) string {
+	ext := filepath.Ext(inputPath)
+	base := strings.TrimSuffix(inputPath, ext)
+	return strings.NewReplacer("{base}", base, "{ext}", ext).Replace(template)
+}
+
+// writeTee writes a snapshot of the output to the tee file, either after the
+// previous snapshots or in place of them.
+func writeTee(file *os.File, data []byte, appendSnapshot bool) error {
+	if !appendSnapshot {
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err := file.Write(data)
+	return err
+}
+
+// writeSegments writes each segment to <dir>/block_NNNN.bin, numbered from 0. A
+// segment that ends part-way through a byte is zero-padded like the main output.
+func writeSegments(dir string, segments [][]byte, ascii, dryRun bool) error {
+	if dryRun {
+		fmt.Printf("Dry run complete. Output would be %d files in %s.\n", len(segments), dir)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, segment := range segments {
+		if ascii {
+			segment = bitedit.ToASCII(segment)
+		}
+		file, err := outfile.Create(filepath.Join(dir, fmt.Sprintf("block_%04d.bin", i)))
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(segment)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hammingDistance counts the bits that differ between data and reference within
+// [startBit, endBit). With verbose, the distance of each differing byte is printed.
+func hammingDistance(data, reference []byte, startBit, endBit int, verbose bool) (int, error) {
+	if len(data) != len(reference) {
+		return 0, fmt.Errorf("input is %d bytes but reference is %d bytes", len(data), len(reference))
+	}
+	totalBits := len(data) * 8
+	if endBit <= 0 || endBit > totalBits {
+		endBit = totalBits
+	}
+	if startBit < 0 || startBit > endBit {
+		return 0, fmt.Errorf("start bit (%d) is out of bounds", startBit)
+	}
+
+	distance := 0
+	for byteIndex := startBit / 8; byteIndex*8 < endBit; byteIndex++ {
+		diff := data[byteIndex] ^ reference[byteIndex]
+		// Mask off bits of a partial first or last byte that lie outside the range
+		for bit := 0; bit < 8; bit++ {
+			pos := byteIndex*8 + bit
+			if pos < startBit || pos >= endBit {
+				diff &^= 1 << (7 - bit)
+			}
+		}
+		byteDistance := bits.OnesCount8(diff)
+		if verbose && byteDistance > 0 {
+			fmt.Printf("Byte %d: %d bits differ\n", byteIndex, byteDistance)
+		}
+		distance += byteDistance
+	}
+	return distance, nil
+}
+
+// printStats prints the bit population and longest runs of bits to w.
+func printStats(w io.Writer, bits []byte) {
+	ones := 0
+	var longest [2]int
+	run := 0
+	for i, bit := range bits {
+		ones += int(bit)
+		if i > 0 && bit == bits[i-1] {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest[bit] {
+			longest[bit] = run
+		}
+	}
+	ratio := 0.0
+	if len(bits) > 0 {
+		ratio = float64(ones) / float64(len(bits))
+	}
+	fmt.Fprintf(w, "Total bits:       %d\n", len(bits))
+	fmt.Fprintf(w, "Ones:             %d\n", ones)
+	fmt.Fprintf(w, "Zeros:            %d\n", len(bits)-ones)
+	fmt.Fprintf(w, "Longest run of 1: %d\n", longest[1])
+	fmt.Fprintf(w, "Longest run of 0: %d\n", longest[0])
+	fmt.Fprintf(w, "Ones ratio:       %.4f\n", ratio)
+}
+
+// fromASCII packs ASCII '0'/'1' characters back into bytes, 8 characters per byte.
+// Whitespace is ignored; any other character is an error.
+func fromASCII(text []byte) ([]byte, error) {
+	bits := make([]byte, 0, len(text))
+	for i, char := range text {
+		switch char {
+		case '0', '1':
+			bits = append(bits, char-'0')
+		case ' ', '\t', '\r', '\n':
+		default:
+			return nil, fmt.Errorf("invalid character %q at offset %d in ASCII bit input", char, i)
+		}
+	}
+	if len(bits)%8 != 0 {
+		return nil, fmt.Errorf("ASCII bit input has %d bits, which is not a multiple of 8", len(bits))
+	}
+	return bitio.BitsToBytes(bits), nil
+}
+
+// formatBits renders a slice of bits as a 0/1 string grouped into bytes.
+func formatBits(bits []byte) string {
+	var sb strings.Builder
+	for i, bit := range bits {
+		if i > 0 && i%8 == 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteByte('0' + bit)
+	}
+	return sb.String()
+}
+
+// appendChecksum appends the additive checksum of data to it. The checksum is the
+// sum of all bytes, wrapping modulo 2^width, and is appended big-endian.
+func appendChecksum(data []byte, width int) []byte {
+	var sum uint32
+	for _, b := range data {
+		sum += uint32(b)
+	}
+	if width == 16 {
+		sum &= 0xFFFF
+		return append(data, byte(sum>>8), byte(sum))
+	}
+	return append(data, byte(sum))
+}
+
+// parseFrameSync parses a --frame-sync argument of the form <binary>:<interval>.
+func parseFrameSync(arg string) ([]byte, int, error) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return nil, 0, fmt.Errorf("invalid --frame-sync: expected <binary>:<interval>, got %s", arg)
+	}
+	sync := make([]byte, len(parts[0]))
+	for i, char := range parts[0] {
+		if char != '0' && char != '1' {
+			return nil, 0, fmt.Errorf("invalid binary sync word for --frame-sync: %s", parts[0])
+		}
+		sync[i] = byte(char - '0')
+	}
+	interval, err := strconv.Atoi(parts[1])
+	if err != nil || interval <= 0 {
+		return nil, 0, fmt.Errorf("invalid interval for --frame-sync: %s", parts[1])
+	}
+	return sync, interval, nil
+}
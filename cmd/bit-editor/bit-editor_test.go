@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PaulW-NZ/Bit-tools/bitedit"
+	"github.com/PaulW-NZ/Bit-tools/bitio"
+)
+
+func TestHammingDistance(t *testing.T) {
+	data := []byte{0xB1, 0x0F}
+	reference := []byte{0x4E, 0x0E}
+	tests := []struct {
+		start, end int
+		want       int
+	}{
+		{0, 0, 9},  // whole input
+		{4, 12, 4}, // partial first and last bytes
+		{8, 16, 1},
+		{15, 16, 1},
+	}
+	for _, tt := range tests {
+		got, err := hammingDistance(data, reference, tt.start, tt.end, false)
+		if err != nil || got != tt.want {
+			t.Errorf("hammingDistance [%d, %d) = %d, %v; want %d", tt.start, tt.end, got, err, tt.want)
+		}
+	}
+	if _, err := hammingDistance(data, reference[:1], 0, 0, false); err == nil {
+		t.Error("lengths differ but no error")
+	}
+}
+
+func TestFromASCII(t *testing.T) {
+	got, err := fromASCII([]byte("10110001 0000\n1111\n"))
+	if err != nil || !bytes.Equal(got, []byte{0xB1, 0x0F}) {
+		t.Errorf("fromASCII = %x, %v; want b10f", got, err)
+	}
+	for _, text := range []string{"1011000", "1011000x"} {
+		if _, err := fromASCII([]byte(text)); err == nil {
+			t.Errorf("fromASCII(%q) gave no error", text)
+		}
+	}
+}
+
+// TestASCIIRoundTrip writes every byte value with --to-ascii-bits and reads the
+// text back with --from-ascii-bits.
+func TestASCIIRoundTrip(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i*167 + 13) // every value, out of order
+	}
+	job := testJob("", data)
+	job.toASCIIBits = true
+	text, _ := runJob(t, job)
+	if len(text) != 8*len(data) || text[:16] != "0000110110110100" {
+		t.Fatalf("--to-ascii-bits wrote %d characters starting %.16q", len(text), text)
+	}
+	job = testJob("", []byte(text))
+	job.fromASCIIBits = true
+	back, _ := runJob(t, job)
+	if !bytes.Equal([]byte(back), data) {
+		t.Errorf("--from-ascii-bits of the text = %x, want %x", back, data)
+	}
+}
+
+func TestAppendChecksum(t *testing.T) {
+	data := []byte{0xFF, 0xFF, 0x03}
+	if got := appendChecksum(append([]byte(nil), data...), 8); !bytes.Equal(got[3:], []byte{0x01}) {
+		t.Errorf("8-bit checksum = %x, want 01", got[3:])
+	}
+	if got := appendChecksum(append([]byte(nil), data...), 16); !bytes.Equal(got[3:], []byte{0x02, 0x01}) {
+		t.Errorf("16-bit checksum = %x, want 0201", got[3:])
+	}
+}
+
+func TestParseFrameSync(t *testing.T) {
+	sync, interval, err := parseFrameSync("1101:64")
+	if err != nil || !bytes.Equal(sync, []byte{1, 1, 0, 1}) || interval != 64 {
+		t.Errorf("parseFrameSync = %v, %d, %v", sync, interval, err)
+	}
+	for _, arg := range []string{"1101", ":64", "1201:64", "1101:0", "1101:x"} {
+		if _, _, err := parseFrameSync(arg); err == nil {
+			t.Errorf("parseFrameSync(%q) gave no error", arg)
+		}
+	}
+}
+
+// TestFrameSyncOffsets checks that --frame-sync 101:5 puts the sync word at
+// output bits 0, 8, 16 and 24, each followed by the next 5 payload bits, the
+// interval not counting the syncs themselves.
+func TestFrameSyncOffsets(t *testing.T) {
+	sync, interval, err := parseFrameSync("101:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte{0xB1, 0x0F}
+	out, err := bitedit.Apply(payload, "t8", bitedit.Options{FrameSync: sync, FrameInterval: interval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outBits := bitio.BytesToBits(out)
+	payloadBits := bitio.BytesToBits(payload)
+	for frame, offset := range []int{0, 8, 16, 24} {
+		if !bytes.Equal(outBits[offset:offset+3], sync) {
+			t.Errorf("bits %d-%d = %v, want the sync word %v", offset, offset+3, outBits[offset:offset+3], sync)
+		}
+		want := payloadBits[frame*5 : min(frame*5+5, len(payloadBits))]
+		if got := outBits[offset+3 : offset+3+len(want)]; !bytes.Equal(got, want) {
+			t.Errorf("frame %d payload = %v, want %v", frame, got, want)
+		}
+	}
+	if got := formatBits(outBits[:28]); got != "10110110 10100100 10100111 1011" {
+		t.Errorf("output = %s", got)
+	}
+}
+
+// testJob returns a job running program over input from stdin, writing to
+// stdout, with the flags at their defaults.
+func testJob(program string, input []byte) *editJob {
+	return &editJob{
+		program:      bitedit.Parse(program),
+		startByte:    -1,
+		endByte:      -1,
+		outputFormat: "raw",
+		stdin:        bytes.NewReader(input),
+		stdout:       new(bytes.Buffer),
+		stderr:       new(bytes.Buffer),
+	}
+}
+
+// runJob processes the job's stdin and returns what it wrote to stdout and stderr.
+func runJob(t *testing.T, job *editJob) (stdout, stderr string) {
+	t.Helper()
+	if err := job.processFile("-", ""); err != nil {
+		t.Fatal(err)
+	}
+	return job.stdout.(*bytes.Buffer).String(), job.stderr.(*bytes.Buffer).String()
+}
+
+// TestDumpBits checks the --dump-bits lines for a known 2-byte input, alone, with
+// a program, and limited to bits 4-12.
+func TestEditStdin(t *testing.T) {
+	// The program arrives on stdin and the data from an -i file
+	data := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(data, []byte{0xB1, 0x0F}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	text, err := loadProgram("", "", true, false, strings.NewReader("# invert\nn8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := testJob(text, nil)
+	if err := job.processFile(data, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := job.stdout.(*bytes.Buffer).Bytes(); !bytes.Equal(got, []byte{0x4E, 0xF0}) {
+		t.Errorf("n8 from stdin over b10f = %x, want 4ef0", got)
+	}
+
+	conflicts := []struct {
+		editString    string
+		dataFromStdin bool
+		want          string
+	}{
+		{"n8", false, "-e and --edit-stdin cannot be used together"},
+		{"", true, "--edit-stdin reads the program from stdin, so -i <file> is required for the data"},
+	}
+	for _, tt := range conflicts {
+		_, err := loadProgram(tt.editString, "", true, tt.dataFromStdin, strings.NewReader("n8"))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("loadProgram(%q, dataFromStdin=%v) error = %v, want %q", tt.editString, tt.dataFromStdin, err, tt.want)
+		}
+	}
+}
+
+func TestOutTemplate(t *testing.T) {
+	const program = "n4t4r8:3"
+	inputs := [][]byte{{0xB1, 0x0F}, {0x12, 0x34, 0x56}}
+	dir := t.TempDir()
+	var paths []string
+	for i, data := range inputs {
+		path := filepath.Join(dir, fmt.Sprintf("in%d.bin", i))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	job := testJob(program, nil)
+	if failed := job.processFiles(paths, "{base}.out{ext}", false); failed != 0 {
+		t.Fatalf("%d files failed: %s", failed, job.stderr.(*bytes.Buffer).String())
+	}
+	for i, data := range inputs {
+		want, _ := runJob(t, testJob(program, data))
+		got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("in%d.out.bin", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("output for input %d = %x, want %x as in a single run", i, got, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		dryRun bool
+		want   string
+	}{
+		{"raw", false, "\xb0\x30"},
+		// The 12 output bits of t6s2 are shown without the padding of the last byte
+		{"bin", false, "101100000011"},
+		{"hex", false, "b030"},
+		{"bin", true, "Dry run complete. Output would be 12 bytes.\nCRC-32: 0x" + fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte("101100000011"))) + "\n"},
+	}
+	for _, tt := range tests {
+		job := testJob("t6s2", []byte{0xB1, 0x0F})
+		job.outputFormat = tt.format
+		job.dryRun = tt.dryRun
+		if got, _ := runJob(t, job); got != tt.want {
+			t.Errorf("--format %s (dry run %v) = %q, want %q", tt.format, tt.dryRun, got, tt.want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		program  string
+		startBit int
+		want     string
+	}{
+		// 10110001 00001111
+		{"", 0, "Total bits:       16\nOnes:             8\nZeros:            8\n" +
+			"Longest run of 1: 4\nLongest run of 0: 4\nOnes ratio:       0.5000\n"},
+		// Without a program the range selects the counted bits: 10001 00001111
+		{"", 3, "Total bits:       13\nOnes:             6\nZeros:            7\n" +
+			"Longest run of 1: 4\nLongest run of 0: 4\nOnes ratio:       0.4615\n"},
+		// The transformed view: 1011 and 0000 are counted
+		{"t4s4", 0, "Total bits:       8\nOnes:             3\nZeros:            5\n" +
+			"Longest run of 1: 2\nLongest run of 0: 4\nOnes ratio:       0.3750\n"},
+	}
+	for _, tt := range tests {
+		job := testJob(tt.program, []byte{0xB1, 0x0F})
+		job.stats = true
+		job.opts.StartBit = tt.startBit
+		if got, _ := runJob(t, job); got != tt.want {
+			t.Errorf("--stats with %q from bit %d =\n%s\nwant\n%s", tt.program, tt.startBit, got, tt.want)
+		}
+	}
+}
+
+func TestByteRange(t *testing.T) {
+	input := []byte{0xB1, 0x0F, 0x55}
+
+	// --start-byte 1 --end-byte 2 edits the same bits as --start 8 --end 16
+	byBytes := testJob("n8", input)
+	byBytes.startByte, byBytes.endByte = 1, 2
+	byBits := testJob("n8", input)
+	byBits.opts.StartBit, byBits.opts.EndBit = 8, 16
+	got, _ := runJob(t, byBytes)
+	if want, _ := runJob(t, byBits); got != want {
+		t.Errorf("n8 over bytes 1-2 = %x, want %x as over bits 8-16", got, want)
+	}
+
+	tests := []struct {
+		startByte, endByte int
+		want               string
+	}{
+		{4, -1, "--start-byte 4 (bit 32) is out of bounds for 3 bytes of input"},
+		{-1, 5, "--end-byte 5 (bit 40) is out of bounds for 3 bytes of input"},
+		{2, 1, "--start-byte 2 (bit 16) cannot be greater than --end-byte 1 (bit 8)"},
+	}
+	for _, tt := range tests {
+		job := testJob("n8", input)
+		job.startByte, job.endByte = tt.startByte, tt.endByte
+		if err := job.processFile("-", ""); err == nil || err.Error() != tt.want {
+			t.Errorf("bytes %d-%d: error = %v, want %q", tt.startByte, tt.endByte, err, tt.want)
+		}
+	}
+}
+
+func TestDryRunChecksum(t *testing.T) {
+	// The check value of the standard CRC-32 is over "123456789"
+	job := testJob("t72", []byte("123456789"))
+	job.dryRun = true
+	want := "Dry run complete. Output would be 9 bytes.\nCRC-32: 0xcbf43926\n"
+	if got, _ := runJob(t, job); got != want {
+		t.Errorf("dry run = %q, want %q", got, want)
+	}
+}
+
+func TestDumpBits(t *testing.T) {
+	tests := []struct {
+		program    string
+		start, end int
+		want       string
+	}{
+		{"", 0, 0, "Input bits:  10110001 00001111\n"},
+		{"n8", 0, 0, "Input bits:  10110001 00001111\nOutput bits: 01001110 11110000\n"},
+		{"t8", 4, 12, "Input bits:  00010000\nOutput bits: 00010000\n"},
+	}
+	for _, tt := range tests {
+		job := testJob(tt.program, []byte{0xB1, 0x0F})
+		job.dumpBits = true
+		job.opts = bitedit.Options{StartBit: tt.start, EndBit: tt.end}
+		if _, stderr := runJob(t, job); stderr != tt.want {
+			t.Errorf("--dump-bits -e %q --start %d --end %d printed %q, want %q", tt.program, tt.start, tt.end, stderr, tt.want)
+		}
+	}
+}
+
+// TestWriteSegments runs a looping block program over a fixed input and checks the
+// numbered files --split-blocks writes, including the short final block.
+func TestWriteSegments(t *testing.T) {
+	var segments [][]byte
+	if _, err := bitedit.Apply([]byte{0xB1, 0x0F, 0x5A}, "[n]16", bitedit.Options{Segments: &segments}); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "blocks")
+	if err := writeSegments(dir, segments, false, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("wrote %d files, want 2", len(entries))
+	}
+	want := map[string][]byte{"block_0000.bin": {0x4E, 0xF0}, "block_0001.bin": {0xA5}}
+	for name, contents := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(got, contents) {
+			t.Errorf("%s = %x, %v; want %x", name, got, err, contents)
+		}
+	}
+}
@@ -0,0 +1,922 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulW-NZ/Bit-tools/crc"
+	"github.com/PaulW-NZ/Bit-tools/internal/outfile"
+)
+
+// crcStandard describes a CRC algorithm. The polynomial and init are in normal
+// form, as in the Rocksoft model and published catalogs. check is the published CRC of the ASCII string "123456789".
+type crcStandard struct {
+	name          string
+	width         int
+	poly          uint64
+	init          uint64
+	refin, refout bool
+	xorout        uint64
+	check         uint64
+}
+
+var standards = []crcStandard{
+	{"CRC-32", 32, 0x04C11DB7, 0xFFFFFFFF, true, true, 0xFFFFFFFF, 0xCBF43926},
+	{"CRC-32C", 32, 0x1EDC6F41, 0xFFFFFFFF, true, true, 0xFFFFFFFF, 0xE3069283},
+	{"CRC-32/BZIP2", 32, 0x04C11DB7, 0xFFFFFFFF, false, false, 0xFFFFFFFF, 0xFC891918},
+	{"CRC-32/MPEG-2", 32, 0x04C11DB7, 0xFFFFFFFF, false, false, 0x0, 0x0376E6E7},
+	{"CRC-16/MODBUS", 16, 0x8005, 0xFFFF, true, true, 0x0, 0x4B37},
+	{"CRC-16/ARC", 16, 0x8005, 0x0, true, true, 0x0, 0xBB3D},
+	{"CRC-16/KERMIT", 16, 0x1021, 0x0, true, true, 0x0, 0x2189},
+	{"CRC-16/X-25", 16, 0x1021, 0xFFFF, true, true, 0xFFFF, 0x906E},
+	{"CRC-16/CCITT-FALSE", 16, 0x1021, 0xFFFF, false, false, 0x0, 0x29B1},
+	{"CRC-16/XMODEM", 16, 0x1021, 0x0, false, false, 0x0, 0x31C3},
+	{"CRC-8/DARC", 8, 0x39, 0x0, true, true, 0x0, 0x15},
+	{"CRC-8/MAXIM", 8, 0x31, 0x0, true, true, 0x0, 0xA1},
+	{"CRC-8/ROHC", 8, 0x07, 0xFF, true, true, 0x0, 0xD0},
+	{"CRC-8/SMBUS", 8, 0x07, 0x0, false, false, 0x0, 0xF4},
+	{"CRC-24/OPENPGP", 24, 0x864CFB, 0xB704CE, false, false, 0x0, 0x21CF02},
+	{"CRC-64/ECMA-182", 64, 0x42F0E1EBA9EA3693, 0x0, false, false, 0x0, 0x6C40DF5F0B497347},
+	{"CRC-64/XZ", 64, 0x42F0E1EBA9EA3693, 0xFFFFFFFFFFFFFFFF, true, true, 0xFFFFFFFFFFFFFFFF, 0x995DC9BBDF1939FA},
+	{"CRC-64/GO-ISO", 64, 0x1B, 0xFFFFFFFFFFFFFFFF, true, true, 0xFFFFFFFFFFFFFFFF, 0xB90956C775A41001},
+}
+
+// params returns the standard as crc.Params.
+func (std crcStandard) params() crc.Params {
+	return crc.Params{Width: std.width, Poly: std.poly, Init: std.init, RefIn: std.refin, RefOut: std.refout, XorOut: std.xorout}
+}
+
+// configLine formats the resolved parameters for --show-config.
+func configLine(p crc.Params) string {
+	return fmt.Sprintf("Config: width=%d poly=0x%x init=0x%x xorout=0x%x refin=%t refout=%t", p.Width, p.Poly, p.Init, p.XorOut, p.RefIn, p.RefOut)
+}
+
+// checkPoly validates a -width/-poly pair. The normal form omits the implicit
+// x^width term; a polynomial written with it (e.g. 0x104C11DB7) is accepted
+// and returned without that top bit, with dropped set so the caller can warn.
+func checkPoly(width int, poly uint64) (fitted uint64, dropped bool, err error) {
+	if width < 1 || width > 64 {
+		return 0, false, fmt.Errorf("unsupported CRC width: %d (must be 1 to 64)", width)
+	}
+	if poly>>uint(width) == 1 {
+		poly &^= 1 << uint(width)
+		dropped = true
+	}
+	if poly>>uint(width) != 0 {
+		return 0, false, fmt.Errorf("polynomial 0x%x does not fit in %d bits; pass a -poly that matches -width", poly, width)
+	}
+	return poly, dropped, nil
+}
+
+// normalizeStandardName lowercases name and drops '-' and '/', so "crc16-modbus"
+// matches "CRC-16/MODBUS".
+func normalizeStandardName(name string) string {
+	return strings.NewReplacer("-", "", "/", "").Replace(strings.ToLower(name))
+}
+
+// lookupStandard finds a standard by its normalized name, or by a prefix of it that
+// only one standard has (so "crc64-ecma" finds CRC-64/ECMA-182).
+func lookupStandard(name string) (crcStandard, error) {
+	want := normalizeStandardName(name)
+	var matches []crcStandard
+	for _, std := range standards {
+		normalized := normalizeStandardName(std.name)
+		if normalized == want {
+			return std, nil
+		}
+		if strings.HasPrefix(normalized, want) {
+			matches = append(matches, std)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	names := make([]string, len(standards))
+	for i, std := range standards {
+		names[i] = std.name
+	}
+	return crcStandard{}, fmt.Errorf("unknown or ambiguous standard '%s'. Known standards are: %s", name, strings.Join(names, ", "))
+}
+
+func printUsage() {
+	fmt.Println("Usage: crc [options] <file>...   (- reads stdin)")
+	fmt.Println("       crc -identify <crc> <file>")
+	fmt.Println("       crc -manifest <file>")
+	fmt.Println("       crc -check <crc|trailing> <file>")
+	fmt.Println("       crc -append -o <out> <file>")
+	fmt.Println("       crc -combine crc1,len1,crc2,len2")
+	fmt.Println("Options:")
+	flag.VisitAll(func(f *flag.Flag) {
+		format := "  -%-10s %s"
+		value := f.DefValue
+		switch f.Name {
+		case "poly", "init", "xorout":
+			// Parse the default value and format as hex
+			num, err := strconv.ParseUint(f.DefValue, 10, 64)
+			if err == nil {
+				value = fmt.Sprintf("0x%x", num)
+			}
+		}
+		fmt.Printf(format, f.Name, f.Usage)
+		fmt.Printf(" (default %s)\n", value)
+	})
+	fmt.Println("\nCommon Standards:")
+	fmt.Println("  CRC-32 (default): -width=32 -poly=0x4c11db7 -init=0xffffffff -xorout=0xffffffff")
+	fmt.Println("  CRC-16/MODBUS:    -width=16 -poly=0x8005  -init=0xffff     -xorout=0x0")
+	fmt.Println("  CRC-8/DARC:       -width=8  -poly=0x39    -init=0x0        -xorout=0x0")
+	fmt.Println("  CRC-5/USB:        -width=5  -poly=0x05    -init=0x1f       -xorout=0x1f")
+}
+
+func main() {
+	// --- Command-Line Flags ---
+	poly := flag.Uint64("poly", 0x04C11DB7, "generator polynomial (normal form, without the implicit x^width term)")
+	initVal := flag.Uint64("init", 0xFFFFFFFF, "initial value")
+	xorOut := flag.Uint64("xorout", 0xFFFFFFFF, "final XOR value")
+	width := flag.Int("width", 32, "CRC width in bits (1 to 64)")
+	refin := flag.Bool("refin", true, "reflect each input byte (process it least significant bit first)")
+	refout := flag.Bool("refout", true, "reflect the CRC register before the final XOR")
+	timing := flag.Bool("timing", false, "print elapsed time and throughput to stderr")
+	showConfig := flag.Bool("show-config", false, "print the resolved parameters to stderr before processing")
+	stateIn := flag.String("state-in", "", "resume from a CRC register saved with -state-out")
+	stateOut := flag.String("state-out", "", "save the CRC register to this file to resume later")
+	identifyCRC := flag.String("identify", "", "identify which known standard produces this CRC value for <file>")
+	manifest := flag.String("manifest", "", "identify the standard for each '<file> <crc>' line of this manifest")
+	std := flag.String("std", "", "use the parameters of a named standard (e.g. crc32, crc16-modbus); explicit parameter flags override it")
+	checkCatalog := flag.Bool("check-catalog", false, "verify every named standard against its published check value and exit")
+	numBits := flag.Int64("bits", -1, "process only the first N bits of each input, for messages that are not a whole number of bytes")
+	checkStr := flag.String("check", "", "verify the CRC of <file> against this value, or against its last bytes with 'trailing'; exit non-zero on a mismatch")
+	appendCRC := flag.Bool("append", false, "write <file> followed by its CRC bytes to -o")
+	outPath := flag.String("o", "", "output file for -append")
+	endian := flag.String("endian", "big", "byte order of the CRC bytes for -append and -check trailing: big or little")
+	combine := flag.String("combine", "", "print the CRC of two concatenated chunks from their CRCs and lengths, given as crc1,len1,crc2,len2")
+	noClobberFlag := flag.Bool("no-clobber", false, "refuse to overwrite an existing -o or -state-out file")
+	force := flag.Bool("force", false, "allow overwriting existing output files, overriding -no-clobber")
+	solvePoly := flag.Bool("solve-poly", false, "search for the poly, init, xorout and reflection of a -width CRC matching every pair in -manifest")
+
+	flag.Usage = printUsage
+	flag.Parse()
+	outfile.NoClobber = *noClobberFlag && !*force
+
+	if *checkCatalog {
+		if err := runCheckCatalog(); err != nil {
+			log.Fatalf("Catalog check failed: %s", err)
+		}
+		return
+	}
+
+	if *std != "" {
+		s, err := lookupStandard(*std)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		setFlags := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+		if !setFlags["width"] {
+			*width = s.width
+		}
+		if !setFlags["poly"] {
+			*poly = s.poly
+		}
+		if !setFlags["init"] {
+			*initVal = s.init
+		}
+		if !setFlags["xorout"] {
+			*xorOut = s.xorout
+		}
+		if !setFlags["refin"] {
+			*refin = s.refin
+		}
+		if !setFlags["refout"] {
+			*refout = s.refout
+		}
+	}
+
+	if *solvePoly {
+		if err := runSolvePoly(*manifest, *width); err != nil {
+			log.Fatalf("Solve failed: %s", err)
+		}
+		return
+	}
+
+	if *manifest != "" || *identifyCRC != "" {
+		if err := runIdentify(*manifest, *identifyCRC, flag.Args()); err != nil {
+			log.Fatalf("Identify failed: %s", err)
+		}
+		return
+	}
+
+	if len(flag.Args()) == 0 && *combine == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if len(flag.Args()) > 1 && (*stateIn != "" || *stateOut != "") {
+		log.Fatalf("-state-in and -state-out need exactly one file")
+	}
+
+	fitted, dropped, err := checkPoly(*width, *poly)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if dropped {
+		fmt.Fprintf(os.Stderr, "Warning: dropping the implicit x^%d term from polynomial 0x%x\n", *width, *poly)
+	}
+	*poly = fitted
+
+	params := crc.Params{Width: *width, Poly: *poly, Init: *initVal, RefIn: *refin, RefOut: *refout, XorOut: *xorOut}
+	if *showConfig {
+		fmt.Fprintln(os.Stderr, configLine(params))
+	}
+
+	if *numBits >= 0 && (*checkStr != "" || *appendCRC) {
+		log.Fatalf("-bits cannot be used with -check or -append")
+	}
+
+	if *combine != "" {
+		if err := runCombine(*combine, params); err != nil {
+			log.Fatalf("Combine failed: %s", err)
+		}
+		return
+	}
+
+	if *checkStr != "" || *appendCRC {
+		if len(flag.Args()) != 1 || *stateIn != "" || *stateOut != "" {
+			log.Fatalf("-check and -append need exactly one file and cannot be used with -state-in or -state-out")
+		}
+		if *endian != "big" && *endian != "little" {
+			log.Fatalf("-endian must be big or little, got '%s'", *endian)
+		}
+		var err error
+		if *appendCRC {
+			err = runAppend(flag.Arg(0), *outPath, *endian == "little", params)
+		} else {
+			err = runCheck(flag.Arg(0), *checkStr, *endian == "little", params)
+		}
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+
+	opts := fileOptions{
+		numBits:    *numBits,
+		stateIn:    *stateIn,
+		stateOut:   *stateOut,
+		configHash: hashConfig(*width, *poly, *initVal, *xorOut, *refin, *refout),
+		timing:     *timing,
+	}
+	if err := runFiles(flag.Args(), params, opts, os.Stdout, os.Stderr); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+// fileOptions are the flags of the default mode, which prints the CRC of each file.
+type fileOptions struct {
+	numBits           int64 // -bits, or -1 for whole files
+	stateIn, stateOut string
+	configHash        uint64 // checked against -state-in and saved with -state-out
+	timing            bool
+}
+
+// runFiles prints the CRC of each path (or stdin for "-") to stdout and, with
+// timing, the throughput to stderr.
+func runFiles(paths []string, params crc.Params, opts fileOptions, stdout, stderr io.Writer) error {
+	d := crc.NewDigest(params)
+	var totalBytes int64
+	start := time.Now()
+
+	for _, filePath := range paths {
+		d.Reset()
+		if opts.stateIn != "" {
+			register, err := loadState(opts.stateIn, opts.configHash)
+			if err != nil {
+				return fmt.Errorf("failed to resume CRC state: %w", err)
+			}
+			d.SetRegister(register)
+		}
+
+		var n int64
+		var err error
+		if opts.numBits >= 0 {
+			n, err = streamFileBits(filePath, opts.numBits, func(chunk []byte) {
+				d.Write(chunk)
+			}, d.WriteBits)
+		} else {
+			n, err = streamFileCRC(filePath, func(chunk []byte) {
+				d.Write(chunk)
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		totalBytes += n
+
+		if opts.stateOut != "" {
+			if err := saveState(opts.stateOut, opts.configHash, d.Register()); err != nil {
+				return fmt.Errorf("failed to save CRC state: %w", err)
+			}
+		}
+
+		fmt.Fprintf(stdout, "CRC-%d for %s: 0x%0*x\n", params.Width, filePath, (params.Width+3)/4, d.Sum64())
+	}
+
+	elapsed := time.Since(start)
+	if opts.timing {
+		mbPerSec := 0.0
+		if elapsed > 0 {
+			mbPerSec = float64(totalBytes) / (1024 * 1024) / elapsed.Seconds()
+		}
+		fmt.Fprintf(stderr, "Processed %d bytes in %v (%.2f MB/s)\n", totalBytes, elapsed, mbPerSec)
+	}
+	return nil
+}
+
+// streamFileCRC streams the file at path, or stdin for "-", through update.
+func streamFileCRC(path string, update func([]byte)) (int64, error) {
+	if path == "-" {
+		return streamCRC(os.Stdin, update)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return streamCRC(file, update)
+}
+
+// streamFileBits streams the first numBits bits of path (or stdin for "-"). Whole
+// bytes go through update a buffer at a time and the bits of a final partial byte
+// through updateBits. It fails if the input is shorter than numBits.
+func streamFileBits(path string, numBits int64, update func([]byte), updateBits func(b byte, count int)) (int64, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		r = file
+	}
+	wholeBytes := numBits / 8
+	total, err := streamCRC(io.LimitReader(r, wholeBytes), update)
+	if err != nil {
+		return total, err
+	}
+	if total < wholeBytes {
+		return total, fmt.Errorf("%s has %d bits, fewer than -bits %d", path, total*8, numBits)
+	}
+	if numBits%8 == 0 {
+		return total, nil
+	}
+	last := make([]byte, 1)
+	if _, err := io.ReadFull(r, last); err != nil {
+		return total, fmt.Errorf("%s has %d bits, fewer than -bits %d", path, total*8, numBits)
+	}
+	updateBits(last[0], int(numBits%8))
+	return total + 1, nil
+}
+
+// streamCRC feeds the reader to update one buffer at a time and returns the number of bytes read.
+func streamCRC(r io.Reader, update func([]byte)) (int64, error) {
+	buf := make([]byte, 64*1024)
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			update(buf[:n])
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// --- Framed Messages ---
+
+// crcBytes returns the CRC as (width+7)/8 bytes in the given byte order.
+func crcBytes(crc uint64, width int, littleEndian bool) []byte {
+	out := make([]byte, (width+7)/8)
+	for i := range out {
+		shift := uint(8 * i)
+		if !littleEndian {
+			shift = uint(8 * (len(out) - 1 - i))
+		}
+		out[i] = byte(crc >> shift)
+	}
+	return out
+}
+
+// runAppend copies path to outPath followed by the CRC of its contents.
+func runAppend(path, outPath string, littleEndian bool, params crc.Params) error {
+	if outPath == "" {
+		return fmt.Errorf("-append needs -o <file>")
+	}
+	out, err := outfile.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer := bufio.NewWriter(out)
+
+	h := crc.New(params)
+	// A failed write is remembered by the bufio.Writer and returned by Flush
+	both := io.MultiWriter(writer, h)
+	if _, err := streamFileCRC(path, func(chunk []byte) {
+		both.Write(chunk)
+	}); err != nil {
+		return err
+	}
+	sum := h.Sum64()
+	if _, err := writer.Write(crcBytes(sum, params.Width, littleEndian)); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Appended CRC-%d 0x%0*x to %s, writing %s\n", params.Width, (params.Width+3)/4, sum, path, outPath)
+	return out.Close()
+}
+
+// runCheck compares the CRC of path with expectedStr. With "trailing" the last
+// (width+7)/8 bytes of the file hold the expected CRC and the rest is checked.
+// A mismatch is returned as an error naming the differing bits.
+func runCheck(path, expectedStr string, littleEndian bool, params crc.Params) error {
+	h := crc.New(params)
+	trailing := expectedStr == "trailing"
+	crcLen := h.Size()
+
+	// In trailing mode the last crcLen bytes seen so far are held back, since
+	// they may be the CRC rather than data.
+	var held []byte
+	if _, err := streamFileCRC(path, func(chunk []byte) {
+		if !trailing {
+			h.Write(chunk)
+			return
+		}
+		held = append(held, chunk...)
+		if len(held) > crcLen {
+			h.Write(held[:len(held)-crcLen])
+			held = append(held[:0], held[len(held)-crcLen:]...)
+		}
+	}); err != nil {
+		return err
+	}
+	sum := h.Sum64()
+	digits := (params.Width + 3) / 4
+
+	var expected uint64
+	if trailing {
+		if len(held) < crcLen {
+			return fmt.Errorf("%s is shorter than a %d-byte CRC", path, crcLen)
+		}
+		for i, b := range held {
+			if littleEndian {
+				expected |= uint64(b) << uint(8*i)
+			} else {
+				expected = expected<<8 | uint64(b)
+			}
+		}
+	} else {
+		var err error
+		expected, err = strconv.ParseUint(expectedStr, 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CRC value '%s' for -check", expectedStr)
+		}
+	}
+
+	if sum != expected {
+		return fmt.Errorf("CRC-%d mismatch for %s: computed 0x%0*x, expected 0x%0*x (differing bits 0x%0*x)",
+			params.Width, path, digits, sum, digits, expected, digits, sum^expected)
+	}
+	fmt.Printf("CRC-%d OK for %s: 0x%0*x\n", params.Width, path, digits, sum)
+	return nil
+}
+
+// --- Standard Identification ---
+
+// runIdentify reports which standard matches each (file, expected CRC) pair, taken
+// either from a manifest or from the -identify value and the single file argument.
+func runIdentify(manifestPath, expectedStr string, args []string) error {
+	var entries []manifestEntry
+	if manifestPath != "" {
+		var err error
+		entries, err = readManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(args) != 1 {
+			return fmt.Errorf("-identify needs exactly one file argument")
+		}
+		entries = append(entries, manifestEntry{args[0], expectedStr})
+	}
+
+	matches := make(map[string]int)
+	unmatched := 0
+	for _, e := range entries {
+		expected, err := strconv.ParseUint(e.expected, 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CRC value '%s' for %s", e.expected, e.path)
+		}
+		data, err := os.ReadFile(e.path)
+		if err != nil {
+			return err
+		}
+		name, ok := identifyStandard(data, expected)
+		if ok {
+			fmt.Printf("%s: %s\n", e.path, name)
+			matches[name]++
+		} else {
+			fmt.Printf("%s: no matching standard\n", e.path)
+			unmatched++
+		}
+	}
+
+	if len(entries) > 1 {
+		fmt.Println("Summary:")
+		for _, std := range standards {
+			if matches[std.name] > 0 {
+				fmt.Printf("  %s: %d files\n", std.name, matches[std.name])
+			}
+		}
+		fmt.Printf("  No match: %d files\n", unmatched)
+	}
+	return nil
+}
+
+// manifestEntry is one "<file> <crc>" line of a manifest.
+type manifestEntry struct {
+	path     string
+	expected string
+}
+
+// readManifest reads "<file> <crc>" lines, skipping blank lines and # comments.
+func readManifest(path string) ([]manifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	for lineNum, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("manifest line %d: expected '<file> <crc>'", lineNum+1)
+		}
+		entries = append(entries, manifestEntry{fields[0], fields[1]})
+	}
+	return entries, nil
+}
+
+// identifyStandard returns the first standard whose CRC of data equals expected.
+// Standards that share a width, polynomial, initial value, and input reflection
+// differ only in how the register is finished, so it is computed once for each group.
+func identifyStandard(data []byte, expected uint64) (string, bool) {
+	type group struct {
+		width      int
+		poly, init uint64
+		refin      bool
+	}
+	registers := make(map[group]uint64)
+	for _, std := range standards {
+		if std.width < 64 && expected>>uint(std.width) != 0 {
+			continue
+		}
+		key := group{std.width, std.poly, std.init, std.refin}
+		d := crc.NewDigest(std.params())
+		register, ok := registers[key]
+		if !ok {
+			d.Write(data)
+			registers[key] = d.Register()
+		} else {
+			d.SetRegister(register)
+		}
+		if d.Sum64() == expected {
+			return std.name, true
+		}
+	}
+	return "", false
+}
+
+// runCheckCatalog computes every standard over "123456789" and compares the result
+// with its published check value.
+func runCheckCatalog() error {
+	data := []byte("123456789")
+	failed := 0
+	for _, std := range standards {
+		got := crc.Checksum(data, std.params())
+		digits := (std.width + 3) / 4
+		if got == std.check {
+			fmt.Printf("OK    %-20s 0x%0*x\n", std.name, digits, got)
+		} else {
+			fmt.Printf("FAIL  %-20s 0x%0*x, expected 0x%0*x\n", std.name, digits, got, digits, std.check)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d standards do not match their check value", failed, len(standards))
+	}
+	return nil
+}
+
+// --- Parameter Search ---
+
+// maxSolveWidth bounds -solve-poly, which tries every polynomial of the width.
+const maxSolveWidth = 16
+
+// maxSolveResults bounds how many matches -solve-poly prints.
+const maxSolveResults = 20
+
+// solvedParams is one set of CRC parameters consistent with every message/CRC pair.
+type solvedParams struct {
+	poly, init, xorout uint64
+	refin, refout      bool
+	freeInitBits       int // init bits the pairs cannot distinguish from xorout
+}
+
+// runSolvePoly reads message/CRC pairs from a manifest and prints every parameter
+// set of the given width that reproduces all of them.
+func runSolvePoly(manifestPath string, width int) error {
+	if manifestPath == "" {
+		return fmt.Errorf("-solve-poly needs -manifest with '<file> <crc>' pairs")
+	}
+	if width < 1 || width > maxSolveWidth {
+		return fmt.Errorf("-solve-poly supports widths 1 to %d, got %d", maxSolveWidth, width)
+	}
+	entries, err := readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if len(entries) < 2 {
+		return fmt.Errorf("-solve-poly needs at least 2 pairs, got %d", len(entries))
+	}
+
+	messages := make([][]byte, len(entries))
+	crcs := make([]uint64, len(entries))
+	for i, e := range entries {
+		crcs[i], err = strconv.ParseUint(e.expected, 0, 64)
+		if err != nil || crcs[i]>>uint(width) != 0 {
+			return fmt.Errorf("invalid %d-bit CRC value '%s' for %s", width, e.expected, e.path)
+		}
+		if messages[i], err = os.ReadFile(e.path); err != nil {
+			return err
+		}
+	}
+	// Two pairs of different lengths give one equation per init bit, which some
+	// init satisfies for almost every polynomial, so nearly all of them would match
+	if len(messages) == 2 && len(messages[0]) != len(messages[1]) {
+		return fmt.Errorf("-solve-poly cannot narrow two pairs of different lengths; add a pair the same length as one of them")
+	}
+
+	results := searchParams(messages, crcs, width)
+	if len(results) == 0 {
+		return fmt.Errorf("no %d-bit CRC parameters match all %d pairs", width, len(entries))
+	}
+	if len(results) > maxSolveResults {
+		fmt.Fprintf(os.Stderr, "%d parameter sets match; showing the first %d. Add more pairs, including two of the same length, to narrow the search.\n", len(results), maxSolveResults)
+		results = results[:maxSolveResults]
+	}
+	digits := (width + 3) / 4
+	for _, r := range results {
+		fmt.Printf("Found: width=%d poly=0x%0*x init=0x%0*x xorout=0x%0*x refin=%t refout=%t",
+			width, digits, r.poly, digits, r.init, digits, r.xorout, r.refin, r.refout)
+		if r.freeInitBits > 0 {
+			fmt.Printf(" (%d init bits undetermined by these pairs)", r.freeInitBits)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// searchParams tries every polynomial with the x^0 term, with input and output
+// both reflected or both not, solving for init and xorout directly rather than
+// searching them.
+func searchParams(messages [][]byte, crcs []uint64, width int) []solvedParams {
+	zeros := make([][]byte, len(messages))
+	for i, msg := range messages {
+		zeros[i] = make([]byte, len(msg))
+	}
+
+	var results []solvedParams
+	mask := uint64(1)<<uint(width) - 1
+	for _, reflected := range []bool{false, true} {
+		for poly := uint64(1); poly <= mask; poly += 2 {
+			params := crc.Params{Width: width, Poly: poly, RefIn: reflected, RefOut: reflected}
+			if solved, ok := solveParams(params, messages, zeros, crcs); ok {
+				results = append(results, solved)
+			}
+		}
+	}
+	return results
+}
+
+// solveParams finds init and xorout for the CRC described by params, whose Init
+// and XorOut are ignored, if any exist. Each CRC is register(msg, 0) ^
+// register(zeros, init) ^ xorout, and the middle term is linear in init, so XORing
+// each pair with the first cancels xorout and leaves a linear system over GF(2) in
+// the bits of init.
+func solveParams(params crc.Params, messages, zeros [][]byte, crcs []uint64) (solvedParams, bool) {
+	params.Init, params.XorOut = 0, 0
+	d := crc.NewDigest(params)
+	// register runs the CRC over data from init and returns it before the final XOR
+	register := func(data []byte, init uint64) uint64 {
+		if params.RefIn {
+			init = crc.Reflect(init, params.Width)
+		}
+		d.SetRegister(init)
+		d.Write(data)
+		return d.Sum64()
+	}
+	// initBasis returns the register after zeros for each single-bit init value
+	initBasis := func(zeros []byte) []uint64 {
+		basis := make([]uint64, params.Width)
+		for k := range basis {
+			basis[k] = register(zeros, 1<<uint(k))
+		}
+		return basis
+	}
+
+	raw := make([]uint64, len(messages))
+	for i, msg := range messages {
+		raw[i] = register(msg, 0)
+		// Messages as long as the first give an equation without init; check it early
+		if len(msg) == len(messages[0]) && raw[i]^raw[0] != crcs[i]^crcs[0] {
+			return solvedParams{}, false
+		}
+	}
+
+	firstBasis := initBasis(zeros[0])
+	var rows, rhs []uint64
+	for i := 1; i < len(messages); i++ {
+		if len(messages[i]) == len(messages[0]) {
+			continue
+		}
+		basis := initBasis(zeros[i])
+		diff := crcs[i] ^ crcs[0] ^ raw[i] ^ raw[0]
+		for j := 0; j < params.Width; j++ {
+			var row uint64
+			for k := 0; k < params.Width; k++ {
+				row |= ((basis[k] ^ firstBasis[k]) >> uint(j) & 1) << uint(k)
+			}
+			rows = append(rows, row)
+			rhs = append(rhs, diff>>uint(j)&1)
+		}
+	}
+
+	origRows := append([]uint64(nil), rows...)
+	origRHS := append([]uint64(nil), rhs...)
+	init, free, ok := solveGF2(rows, rhs, params.Width)
+	if !ok {
+		return solvedParams{}, false
+	}
+	// When init is not fully determined, prefer the conventional all-zeros or
+	// all-ones value if it is one of the solutions
+	if free > 0 {
+		for _, candidate := range []uint64{0, uint64(1)<<uint(params.Width) - 1} {
+			if satisfiesGF2(origRows, origRHS, candidate) {
+				init = candidate
+				break
+			}
+		}
+	}
+	xorout := crcs[0] ^ raw[0] ^ register(zeros[0], init)
+	return solvedParams{poly: params.Poly, init: init, xorout: xorout, refin: params.RefIn, refout: params.RefOut, freeInitBits: free}, true
+}
+
+// solveGF2 solves the system whose row i is the bit mask rows[i] with right-hand
+// side rhs[i], over n unknowns. It returns the solution with every free unknown set
+// to zero and the number of free unknowns.
+func solveGF2(rows, rhs []uint64, n int) (uint64, int, bool) {
+	var pivotCols []int
+	rank := 0
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := rank; r < len(rows); r++ {
+			if rows[r]>>uint(col)&1 == 1 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		rows[rank], rows[pivot] = rows[pivot], rows[rank]
+		rhs[rank], rhs[pivot] = rhs[pivot], rhs[rank]
+		for r := range rows {
+			if r != rank && rows[r]>>uint(col)&1 == 1 {
+				rows[r] ^= rows[rank]
+				rhs[r] ^= rhs[rank]
+			}
+		}
+		pivotCols = append(pivotCols, col)
+		rank++
+	}
+	for r := rank; r < len(rows); r++ {
+		if rhs[r] != 0 {
+			return 0, 0, false
+		}
+	}
+	var solution uint64
+	for i, col := range pivotCols {
+		solution |= rhs[i] << uint(col)
+	}
+	return solution, n - rank, true
+}
+
+// satisfiesGF2 reports whether x solves every row of the system.
+func satisfiesGF2(rows, rhs []uint64, x uint64) bool {
+	for i, row := range rows {
+		if uint64(bits.OnesCount64(row&x)&1) != rhs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Resumable State ---
+
+// hashConfig fingerprints the CRC parameters so a saved register is only ever
+// resumed with the configuration that produced it. The reflection flags are only
+// hashed when they differ from the defaults, so older state files still load.
+func hashConfig(width int, poly, initVal, xorOut uint64, refin, refout bool) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%x:%x:%x", width, poly, initVal, xorOut)
+	if !refin || !refout {
+		fmt.Fprintf(h, ":%t:%t", refin, refout)
+	}
+	return h.Sum64()
+}
+
+// saveState writes the CRC register (before the final XOR) and the config hash.
+func saveState(path string, configHash, register uint64) error {
+	file, err := outfile.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "config=%016x crc=%x\n", configHash, register); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func loadState(path string, configHash uint64) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var savedHash, register uint64
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "config=%x crc=%x", &savedHash, &register); err != nil {
+		return 0, fmt.Errorf("malformed state file %s", path)
+	}
+	if savedHash != configHash {
+		return 0, fmt.Errorf("state file %s was saved with different CRC parameters", path)
+	}
+	return register, nil
+}
+
+// --- Combining CRCs ---
+
+// runCombine parses "crc1,len1,crc2,len2" and prints the CRC of the two chunks
+// concatenated. len1 is not needed for the result; it only sets the total length
+// reported.
+func runCombine(spec string, params crc.Params) error {
+	fields := strings.Split(spec, ",")
+	if len(fields) != 4 {
+		return fmt.Errorf("-combine needs crc1,len1,crc2,len2, got '%s'", spec)
+	}
+	var values [4]uint64
+	for i, field := range fields {
+		v, err := strconv.ParseUint(strings.TrimSpace(field), 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' in -combine", field)
+		}
+		values[i] = v
+	}
+	mask := ^uint64(0) >> uint(64-params.Width)
+	if values[0]&^mask != 0 || values[2]&^mask != 0 {
+		return fmt.Errorf("CRC values in -combine must fit in %d bits", params.Width)
+	}
+	if values[3] > math.MaxInt64 {
+		return fmt.Errorf("len2 %d in -combine is too large", values[3])
+	}
+	combined := crc.Combine(values[0], values[2], int(values[3]), params)
+	fmt.Printf("CRC-%d of %d combined bytes: 0x%0*x\n", params.Width, values[1]+values[3], (params.Width+3)/4, combined)
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/PaulW-NZ/Bit-tools/crc"
+)
+
+func TestCatalogCheckValues(t *testing.T) {
+	for _, std := range standards {
+		if got := crc.Checksum([]byte("123456789"), std.params()); got != std.check {
+			t.Errorf("%s: check = 0x%x, want 0x%x", std.name, got, std.check)
+		}
+	}
+}
+
+// TestStreamCRCShortReads feeds streamCRC one byte per read, as a slow pipe or
+// network file may.
+func TestStreamCRCShortReads(t *testing.T) {
+	d := crc.New(crc.Params{Width: 32, Poly: 0x04C11DB7, Init: 0xFFFFFFFF, RefIn: true, RefOut: true, XorOut: 0xFFFFFFFF})
+	r := iotest.DataErrReader(iotest.OneByteReader(bytes.NewReader([]byte("123456789"))))
+	n, err := streamCRC(r, func(b []byte) { d.Write(b) })
+	if err != nil || n != 9 || d.Sum64() != 0xCBF43926 {
+		t.Errorf("streamCRC = %d bytes, 0x%x, %v; want 9 bytes, 0xcbf43926", n, d.Sum64(), err)
+	}
+}
+
+func TestLookupStandard(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"crc16-modbus", "CRC-16/MODBUS"},
+		{"CRC-64/XZ", "CRC-64/XZ"},
+		{"crc64-ecma", "CRC-64/ECMA-182"},
+	}
+	for _, tt := range tests {
+		if std, err := lookupStandard(tt.name); err != nil || std.name != tt.want {
+			t.Errorf("lookupStandard(%q) = %q, %v; want %q", tt.name, std.name, err, tt.want)
+		}
+	}
+	if _, err := lookupStandard("crc16"); err == nil {
+		t.Error("ambiguous prefix crc16 accepted")
+	}
+}
+
+// TestConfigLine checks that --show-config reports the resolved polynomial of the
+// default standard, CRC-32, and of a -std lookup.
+func TestConfigLine(t *testing.T) {
+	std, _ := lookupStandard("crc16-modbus")
+	tests := []struct {
+		params crc.Params
+		want   string
+	}{
+		{standards[0].params(), "Config: width=32 poly=0x4c11db7 init=0xffffffff xorout=0xffffffff refin=true refout=true"},
+		{std.params(), "Config: width=16 poly=0x8005 init=0xffff xorout=0x0 refin=true refout=true"},
+	}
+	for _, tt := range tests {
+		if got := configLine(tt.params); got != tt.want {
+			t.Errorf("configLine = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// TestAppendCheck appends CRC-16/MODBUS to a file in each byte order, checks
+// the result with -check trailing, and checks an explicit value both ways.
+func TestAppendCheck(t *testing.T) {
+	std, _ := lookupStandard("CRC-16/MODBUS")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "msg")
+	if err := os.WriteFile(path, []byte("123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, littleEndian := range []bool{false, true} {
+		framed := filepath.Join(dir, fmt.Sprintf("framed-%t", littleEndian))
+		if err := runAppend(path, framed, littleEndian, std.params()); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(framed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "123456789\x4b\x37"
+		if littleEndian {
+			want = "123456789\x37\x4b"
+		}
+		if string(got) != want {
+			t.Errorf("-append (little endian %t) wrote %q, want %q", littleEndian, got, want)
+		}
+		if err := runCheck(framed, "trailing", littleEndian, std.params()); err != nil {
+			t.Errorf("-check trailing (little endian %t): %v", littleEndian, err)
+		}
+		if err := runCheck(framed, "trailing", !littleEndian, std.params()); err == nil {
+			t.Errorf("-check trailing with the wrong byte order (little endian %t) passed", !littleEndian)
+		}
+	}
+
+	if err := runCheck(path, "0x4b37", false, std.params()); err != nil {
+		t.Errorf("-check 0x4b37: %v", err)
+	}
+	err := runCheck(path, "0x4b36", false, std.params())
+	want := "CRC-16 mismatch for " + path + ": computed 0x4b37, expected 0x4b36 (differing bits 0x0001)"
+	if err == nil || err.Error() != want {
+		t.Errorf("-check 0x4b36 error = %v, want %q", err, want)
+	}
+}
+
+// runFilesOutput runs the default mode over paths and returns what it prints to
+// stdout and stderr.
+func runFilesOutput(t *testing.T, paths []string, params crc.Params, opts fileOptions) (stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	if err := runFiles(paths, params, opts, &out, &errOut); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String()
+}
+
+// writeTemp writes data to name in a temporary directory and returns its path.
+func writeTemp(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestResumeState computes a CRC over two halves, saving the register after the
+// first with -state-out and resuming from it with -state-in, and checks that it
+// matches the single-pass CRC. A state saved with other parameters is refused.
+func TestResumeState(t *testing.T) {
+	data := bytes.Repeat([]byte("resumable hashing of huge files "), 5000)
+	whole := writeTemp(t, "whole", data)
+	first := writeTemp(t, "first", data[:len(data)/2])
+	second := writeTemp(t, "second", data[len(data)/2:])
+	state := filepath.Join(t.TempDir(), "state")
+
+	for _, std := range []string{"crc32", "crc16-ccitt-false", "crc64-xz"} {
+		s, _ := lookupStandard(std)
+		params := s.params()
+		configHash := hashConfig(params.Width, params.Poly, params.Init, params.XorOut, params.RefIn, params.RefOut)
+		want, _ := runFilesOutput(t, []string{whole}, params, fileOptions{numBits: -1, configHash: configHash})
+		runFilesOutput(t, []string{first}, params, fileOptions{numBits: -1, stateOut: state, configHash: configHash})
+		got, _ := runFilesOutput(t, []string{second}, params, fileOptions{numBits: -1, stateIn: state, configHash: configHash})
+		if strings.Replace(got, second, whole, 1) != want {
+			t.Errorf("%s: resumed %q, want %q", s.name, got, want)
+		}
+	}
+
+	err := runFiles([]string{second}, standards[0].params(), fileOptions{numBits: -1, stateIn: state, configHash: 1}, io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "different CRC parameters") {
+		t.Errorf("resuming with other parameters: error = %v", err)
+	}
+}
+
+// TestMultipleFilesAndStdin checks that each argument gets its own CRC line in
+// order, with "-" reading stdin.
+func TestMultipleFilesAndStdin(t *testing.T) {
+	first := writeTemp(t, "first", []byte("123456789"))
+	second := writeTemp(t, "second", []byte("hello world"))
+	stdin, err := os.Open(writeTemp(t, "stdin", []byte("123456789")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	got, _ := runFilesOutput(t, []string{first, "-", second}, standards[0].params(), fileOptions{numBits: -1})
+	want := fmt.Sprintf("CRC-32 for %s: 0xcbf43926\nCRC-32 for -: 0xcbf43926\nCRC-32 for %s: 0x0d4a1185\n", first, second)
+	if got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+// TestTiming checks that -timing prints a throughput line to stderr, counting
+// every file, and leaves the CRC lines unchanged.
+func TestTiming(t *testing.T) {
+	first := writeTemp(t, "first", []byte("123456789"))
+	second := writeTemp(t, "second", []byte("hello world"))
+	params := standards[0].params()
+	want, quiet := runFilesOutput(t, []string{first, second}, params, fileOptions{numBits: -1})
+	if quiet != "" {
+		t.Errorf("stderr without -timing = %q, want nothing", quiet)
+	}
+	got, timing := runFilesOutput(t, []string{first, second}, params, fileOptions{numBits: -1, timing: true})
+	if got != want {
+		t.Errorf("CRC lines with -timing = %q, want %q", got, want)
+	}
+	if !regexp.MustCompile(`^Processed 20 bytes in \S+ \(\d+\.\d\d MB/s\)\n$`).MatchString(timing) {
+		t.Errorf("timing line = %q", timing)
+	}
+}
+
+// TestCheckPoly checks that a polynomial with bits above -width is rejected
+// rather than silently truncated.
+func TestCheckPoly(t *testing.T) {
+	tests := []struct {
+		width   int
+		poly    uint64
+		wantErr string
+	}{
+		{8, 0x8005, "polynomial 0x8005 does not fit in 8 bits; pass a -poly that matches -width"},
+		{16, 0x104C11DB7, "polynomial 0x104c11db7 does not fit in 16 bits; pass a -poly that matches -width"},
+		{0, 0x07, "unsupported CRC width: 0 (must be 1 to 64)"},
+		{65, 0x07, "unsupported CRC width: 65 (must be 1 to 64)"},
+	}
+	for _, tt := range tests {
+		_, _, err := checkPoly(tt.width, tt.poly)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("checkPoly(%d, 0x%x) error = %v, want %q", tt.width, tt.poly, err, tt.wantErr)
+		}
+	}
+}
+
+// TestCheckPolyMatchingWidth checks that a polynomial that fits -width passes
+// through, and that one written with its implicit x^width term has it dropped.
+func TestCheckPolyMatchingWidth(t *testing.T) {
+	tests := []struct {
+		width       int
+		poly        uint64
+		want        uint64
+		wantDropped bool
+	}{
+		{8, 0x07, 0x07, false},
+		{16, 0x8005, 0x8005, false},
+		{32, 0x04C11DB7, 0x04C11DB7, false},
+		{32, 0x104C11DB7, 0x04C11DB7, true},
+		{64, 0x42F0E1EBA9EA3693, 0x42F0E1EBA9EA3693, false},
+	}
+	for _, tt := range tests {
+		got, dropped, err := checkPoly(tt.width, tt.poly)
+		if err != nil || got != tt.want || dropped != tt.wantDropped {
+			t.Errorf("checkPoly(%d, 0x%x) = 0x%x, %t, %v; want 0x%x, %t", tt.width, tt.poly, got, dropped, err, tt.want, tt.wantDropped)
+		}
+	}
+}
+
+func TestIdentifyStandard(t *testing.T) {
+	data := []byte("123456789")
+	// Every check value identifies its own standard, including those that share a
+	// cached register with an earlier one
+	for _, std := range standards {
+		name, ok := identifyStandard(data, std.check)
+		if !ok || name != std.name {
+			t.Errorf("identifyStandard(0x%x) = %q, %t; want %q", std.check, name, ok, std.name)
+		}
+	}
+	if name, ok := identifyStandard(data, 0x12345678); ok {
+		t.Errorf("identifyStandard matched %q for an unknown CRC", name)
+	}
+}
+
+func TestSearchParams(t *testing.T) {
+	std, _ := lookupStandard("CRC-8/ROHC")
+	messages := [][]byte{[]byte("123456789"), []byte("hello"), []byte("world"), []byte("a longer message")}
+	crcs := make([]uint64, len(messages))
+	for i, msg := range messages {
+		crcs[i] = crc.Checksum(msg, std.params())
+	}
+	for _, r := range searchParams(messages, crcs, 8) {
+		if r.poly == std.poly && r.init == std.init && r.xorout == std.xorout && r.refin == std.refin && r.refout == std.refout {
+			return
+		}
+	}
+	t.Errorf("searchParams did not find %s", std.name)
+}
+
+// TestSearchParamsTwoPairs checks that two pairs of the same length recover
+// CRC-16/XMODEM, and that -solve-poly rejects two pairs of different lengths.
+func TestSearchParamsTwoPairs(t *testing.T) {
+	std, _ := lookupStandard("CRC-16/XMODEM")
+	messages := [][]byte{[]byte("123456789"), []byte("abcdefghi")}
+	crcs := []uint64{std.check, crc.Checksum(messages[1], std.params())}
+	results := searchParams(messages, crcs, 16)
+	if len(results) != 1 {
+		t.Fatalf("searchParams found %d parameter sets, want 1: %+v", len(results), results)
+	}
+	want := solvedParams{poly: 0x1021, init: 0, xorout: 0, freeInitBits: 16}
+	if results[0] != want {
+		t.Errorf("searchParams = %+v, want %+v", results[0], want)
+	}
+
+	dir := t.TempDir()
+	var manifest bytes.Buffer
+	for i, msg := range [][]byte{[]byte("123456789"), []byte("hello world")} {
+		path := filepath.Join(dir, fmt.Sprintf("msg%d", i))
+		if err := os.WriteFile(path, msg, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&manifest, "%s 0x%x\n", path, crc.Checksum(msg, std.params()))
+	}
+	manifestPath := filepath.Join(dir, "pairs.txt")
+	if err := os.WriteFile(manifestPath, manifest.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runSolvePoly(manifestPath, 16); err == nil || !strings.Contains(err.Error(), "two pairs of different lengths") {
+		t.Errorf("runSolvePoly with two pairs of different lengths: error = %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math/bits"
+	"testing"
+)
+
+// TestSingleErrorSweep flips every bit after the length header, one at a time, and
+// checks that decode still returns the original data.
+func TestSingleErrorSweep(t *testing.T) {
+	data := []byte{0xB1, 0x0F, 0x5A, 0xC3, 0x96, 0x00, 0xFF, 0x3C, 0x81}
+	for m := 3; m <= 6; m++ {
+		for _, extended := range []bool{false, true} {
+			for _, systematic := range []bool{false, true} {
+				encoded := encode(data, m, extended, systematic)
+				if decoded, _ := decode(encoded, m, extended, false, systematic); !bytes.Equal(decoded, data) {
+					t.Fatalf("m=%d extended=%t systematic=%t: clean decode = %x, want %x", m, extended, systematic, decoded, data)
+				}
+				for bit := 64; bit < encodedBitLength(len(data), m, extended); bit++ {
+					received := append([]byte(nil), encoded...)
+					received[bit/8] ^= 0x80 >> uint(bit%8)
+					decoded, results := decode(received, m, extended, false, systematic)
+					if !bytes.Equal(decoded, data) {
+						t.Errorf("m=%d extended=%t systematic=%t: error at bit %d decoded to %x, want %x", m, extended, systematic, bit, decoded, data)
+					}
+					corrected := 0
+					for _, r := range results {
+						if r.Corrected != nil {
+							corrected++
+						}
+					}
+					if corrected != 1 {
+						t.Errorf("m=%d extended=%t systematic=%t: error at bit %d reported %d corrected blocks, want 1", m, extended, systematic, bit, corrected)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestDoubleErrorDetected checks that the extended code flags, rather than
+// miscorrects, two errors in one block.
+func TestDoubleErrorDetected(t *testing.T) {
+	data := []byte{0xB1, 0x0F}
+	for m := 3; m <= 6; m++ {
+		encoded := encode(data, m, true, false)
+		encoded[8] ^= 0x60 // two bits of the first block
+		_, results := decode(encoded, m, true, false, false)
+		if len(results) == 0 || results[0].DoubleError == nil || !*results[0].DoubleError {
+			t.Errorf("m=%d: double error in block 0 not reported as uncorrectable: %+v", m, results)
+		}
+	}
+}
+
+// TestCapacityReport decodes two bytes (four Hamming(7,4) blocks) with no errors in
+// blocks 0 and 3, one in block 1, and two parity-bit errors in block 2, which the
+// decoder miscorrects into a data bit.
+func TestCapacityReport(t *testing.T) {
+	reference := []byte{0xB1, 0x0F}
+	received := encode(reference, 3, false, false)
+	for _, bit := range []int{64 + 7, 64 + 14, 64 + 15} {
+		received[bit/8] ^= 0x80 >> uint(bit%8)
+	}
+	decoded, _ := decode(received, 3, false, false, false)
+
+	var report bytes.Buffer
+	printCapacityReport(&report, evaluate(received, decoded, reference, 3, false, false), false)
+	want := `Error-correction report:
+  Theoretical capacity: corrects 1 error per block
+  Blocks compared: 4, bit errors: 3, header bit errors: 0
+  0 errors:  2 blocks (2 decoded correctly, 0 miscorrected)
+  1 error:   1 blocks (1 corrected, 0 missed)
+  2+ errors: 1 blocks (0 decoded correctly, 1 decoded wrongly)
+`
+	if report.String() != want {
+		t.Errorf("report =\n%s\nwant\n%s", report.String(), want)
+	}
+}
+
+// TestResync shifts a sync-prefixed stream by three bits, so its blocks only decode
+// correctly once the sync pattern has restored the alignment.
+func TestResync(t *testing.T) {
+	data := []byte{0xB1, 0x0F, 0x5A}
+	syncBits, err := parseBinary("1111000011110000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shifted := prependSync(prependSync(encode(data, 4, false, false), syncBits), []uint{1, 0, 1})
+
+	if decoded, _ := decode(shifted, 4, false, false, false); bytes.Equal(decoded, data) {
+		t.Fatal("the shifted stream decoded correctly without resync")
+	}
+	aligned, offset, err := alignAfterSync(shifted, syncBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 3 {
+		t.Errorf("sync pattern found at bit %d, want 3", offset)
+	}
+	if decoded, _ := decode(aligned, 4, false, false, false); !bytes.Equal(decoded, data) {
+		t.Errorf("decoded after resync = %x, want %x", decoded, data)
+	}
+}
+
+// TestExpect checks the comparison -expect makes: a matching expected file passes,
+// and a wrong or short one is reported at the first differing byte.
+func TestExpect(t *testing.T) {
+	output := encode([]byte{0xB1, 0x0F, 0x5A}, 3, false, false)
+	wrong := append([]byte(nil), output...)
+	wrong[10] ^= 0x01
+	tests := []struct {
+		name     string
+		expected []byte
+		want     int
+	}{
+		{"matching", output, -1},
+		{"wrong byte", wrong, 10},
+		{"short", output[:9], 9},
+	}
+	for _, tt := range tests {
+		if got := firstDifference(output, tt.expected); got != tt.want {
+			t.Errorf("%s: first difference at %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestJSONReport checks the -json-report entries for a byte encoded as two
+// Hamming(7,4) blocks with position 5 of the first block flipped.
+func TestJSONReport(t *testing.T) {
+	tests := []struct {
+		extended bool
+		flip     int // bit of the encoded stream to flip
+		want     string
+	}{
+		{false, 64 + 4, `[{"block":0,"syndrome":5,"corrected_position":5},` +
+			`{"block":1,"syndrome":0,"corrected_position":null}]`},
+		// The extended block starts with the overall parity bit
+		{true, 64 + 5, `[{"block":0,"syndrome":5,"corrected_position":5,"double_error":false},` +
+			`{"block":1,"syndrome":0,"corrected_position":null,"double_error":false}]`},
+	}
+	for _, tt := range tests {
+		encoded := encode([]byte{0xB1}, 3, tt.extended, false)
+		encoded[tt.flip/8] ^= 0x80 >> uint(tt.flip%8)
+		_, results := decode(encoded, 3, tt.extended, false, false)
+		report, err := json.Marshal(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(report) != tt.want {
+			t.Errorf("extended=%t: report = %s, want %s", tt.extended, report, tt.want)
+		}
+	}
+}
+
+// TestLittleEndianHeader checks that -header-endian little stores the byte count
+// least significant byte first and that swapping it back on decode restores the data.
+func TestLittleEndianHeader(t *testing.T) {
+	data := []byte{0xB1, 0x0F, 0x5A, 0xC3, 0x96}
+	encoded := encode(data, 4, true, false)
+	swapHeader(encoded)
+	if got := binary.LittleEndian.Uint64(encoded[:8]); got != uint64(len(data)) {
+		t.Fatalf("little-endian header = %d, want %d", got, len(data))
+	}
+
+	swapHeader(encoded)
+	if decoded, _ := decode(encoded, 4, true, false, false); !bytes.Equal(decoded, data) {
+		t.Errorf("round trip = %x, want %x", decoded, data)
+	}
+}
+
+// TestInjectErrors checks that -inject flips the same bits for the same -seed,
+// different bits for another seed, and reports exactly the bits it flipped.
+func TestInjectErrors(t *testing.T) {
+	clean := encode([]byte{0xB1, 0x0F, 0x5A, 0xC3}, 3, false, false)
+	numBits := encodedBitLength(4, 3, false)
+	inject := func(seed int64) ([]byte, int) {
+		data := append([]byte(nil), clean...)
+		return data, injectErrors(data, numBits, 0.1, seed)
+	}
+
+	first, flipped := inject(7)
+	again, flippedAgain := inject(7)
+	if !bytes.Equal(first, again) || flipped != flippedAgain {
+		t.Errorf("seed 7 gave %x (%d flips) and then %x (%d flips)", first, flipped, again, flippedAgain)
+	}
+	if other, _ := inject(8); bytes.Equal(other, first) {
+		t.Error("seeds 7 and 8 flipped the same bits")
+	}
+
+	differing := 0
+	for i := range clean {
+		differing += bits.OnesCount8(clean[i] ^ first[i])
+	}
+	if flipped == 0 || differing != flipped {
+		t.Errorf("reported %d flips, but %d bits differ", flipped, differing)
+	}
+}
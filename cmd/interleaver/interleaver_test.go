@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessInterleave(t *testing.T) {
+	// Output element j is input element pattern[j]; the final partial block is
+	// passed through.
+	got, err := processInterleave([]byte{0xA1, 0xB2, 0xC3, 0xD4}, "2,0,1", 8, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xC3, 0xA1, 0xB2, 0xD4}; !bytes.Equal(got, want) {
+		t.Errorf("interleave = %x, want %x", got, want)
+	}
+	// 4-bit elements
+	got, _ = processInterleave([]byte{0xB1}, "1,0", 4, false)
+	if !bytes.Equal(got, []byte{0x1B}) {
+		t.Errorf("nibble swap = %x, want 1b", got)
+	}
+
+	if _, err := processInterleave(nil, "0,0,1", 1, false); err == nil {
+		t.Error("repeated index accepted as a pattern")
+	}
+}
+
+// TestRoundTrips checks that every permute mode's inverse restores the input,
+// including a trailing partial block.
+func TestRoundTrips(t *testing.T) {
+	data := bytes.Repeat([]byte{0xB1, 0x0F, 0x5A, 0xC3, 0x77}, 7)
+	const pattern = "3,0,4,1,2"
+
+	for _, elementSize := range []int{1, 3, 8} {
+		forward, _ := processInterleave(data, pattern, elementSize, false)
+		back, _ := processInterleave(forward, pattern, elementSize, true)
+		if !bytes.Equal(back, data) {
+			t.Errorf("element size %d: inverse gave %x", elementSize, back)
+		}
+
+		forward, _ = processTwoLevelInterleave(data, pattern, "1,0", elementSize, false)
+		back, _ = processTwoLevelInterleave(forward, pattern, "1,0", elementSize, true)
+		if !bytes.Equal(back, data) {
+			t.Errorf("element size %d: two-level inverse gave %x", elementSize, back)
+		}
+	}
+
+	bits := make([]byte, 3*4*2)
+	for i := range bits {
+		bits[i] = byte(i*7) % 3 & 1
+	}
+	columns := transposeElements(bits, 3, 4, 2, false)
+	if back := transposeElements(columns, 3, 4, 2, true); !bytes.Equal(back, bits) {
+		t.Errorf("matrix inverse gave %v, want %v", back, bits)
+	}
+}
+
+// TestOverlap checks --overlap 1 on the nibbles B 1 0 F with the swap pattern 1,0:
+// the windows B1, 10 and 0F become 1B, 01 and F0, which are either concatenated or
+// XORed together at the offsets they were taken from.
+func TestOverlap(t *testing.T) {
+	tests := []struct {
+		xor  bool
+		want []byte
+	}{
+		{false, []byte{0x1B, 0x01, 0xF0}},
+		// 1 B . .  ^  . 0 1 .  ^  . . F 0
+		{true, []byte{0x1B, 0xE0}},
+	}
+	for _, tt := range tests {
+		got, err := processOverlapInterleave([]byte{0xB1, 0x0F}, "1,0", 4, false, 1, tt.xor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("overlap 1 (xor %v) = %x, want %x", tt.xor, got, tt.want)
+		}
+	}
+}
+
+// writeInputs writes each of data to its own file in a temporary directory and
+// returns the paths.
+func writeInputs(t *testing.T, data ...[]byte) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, len(data))
+	for i, d := range data {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("in%d.bin", i))
+		if err := os.WriteFile(paths[i], d, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// TestEqualizeRoundTrip checks that de-muxing an --equalize mux gives back every
+// input, zero-padded to the longest.
+func TestEqualizeRoundTrip(t *testing.T) {
+	inputs := [][]byte{{0xA1, 0xA2, 0xA3}, {0xB1}, {0xC1, 0xC2}}
+	paths := writeInputs(t, inputs...)
+	muxed := filepath.Join(filepath.Dir(paths[0]), "muxed.bin")
+	cycleBits := []int{8, 8, 8}
+	if err := runMuxMode(paths, muxed, cycleBits, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := runDeMuxMode(muxed, "", cycleBits); err != nil {
+		t.Fatal(err)
+	}
+	for i, input := range inputs {
+		got, err := os.ReadFile(generateSplitFileName(muxed, "", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]byte, 3)
+		copy(want, input)
+		if !bytes.Equal(got, want) {
+			t.Errorf("stream %d = %x, want %x", i, got, want)
+		}
+	}
+}
+
+// TestSaveTable checks that a --random table saved with --save-table and read back
+// with --pattern-file gives the same pattern and output.
+func TestSaveTable(t *testing.T) {
+	pattern, err := randomPattern(12, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := filepath.Join(t.TempDir(), "table.txt")
+	if err := writePatternFile(table, pattern); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := readPatternFile(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != pattern {
+		t.Fatalf("reloaded table %s, want %s", loaded, pattern)
+	}
+
+	data := bytes.Repeat([]byte{0xB1, 0x0F, 0x5A}, 4)
+	want, _ := processInterleave(data, pattern, 4, false)
+	got, err := processInterleave(data, loaded, 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output with the reloaded table = %x, want %x", got, want)
+	}
+}
+
+// TestJosephusOrdering checks josephus:3 over 7 elements, removing every third one
+// from the circle 0..6, and that its inverse restores the input.
+func TestJosephusOrdering(t *testing.T) {
+	pattern, err := orderingPattern("josephus:3", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern != "2,5,1,6,4,0,3" {
+		t.Fatalf("josephus:3 over 7 = %s, want 2,5,1,6,4,0,3", pattern)
+	}
+
+	data := []byte{0xB1, 0x0F, 0x5A, 0xC3, 0x77}
+	forward, _ := processInterleave(data, pattern, 4, false)
+	if back, _ := processInterleave(forward, pattern, 4, true); !bytes.Equal(back, data) {
+		t.Errorf("inverse gave %x, want %x", back, data)
+	}
+
+	if _, err := orderingPattern("josephus:3", 0); err == nil {
+		t.Error("ordering without --block accepted")
+	}
+}
+
+func TestPermutationIssues(t *testing.T) {
+	tests := []struct {
+		pattern []int
+		want    []string
+	}{
+		{[]int{2, 0, 1}, nil},
+		{[]int{0, 5, 2, 5, 1, 3}, []string{
+			"index 5 appears 2 times at positions 1 and 3",
+			"index 4 is missing",
+		}},
+		{[]int{0, 1, 9, 2}, []string{
+			"index 9 out of range for size 4 at position 2",
+			"index 3 is missing",
+		}},
+	}
+	for _, tt := range tests {
+		got := permutationIssues(tt.pattern)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("permutationIssues(%v) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+
+	// A pattern that is used rather than checked reports its first problem
+	_, err := parsePattern("0,5,2,5,1,3")
+	want := "invalid pattern: index 5 appears 2 times at positions 1 and 3 (must be a permutation of 0..5)"
+	if err == nil || err.Error() != want {
+		t.Errorf("parsePattern error = %v, want %q", err, want)
+	}
+}
+
+// TestDeMuxRoundTripCheck checks that --roundtrip-check passes for a de-mux and
+// names the first differing bit when the split files are re-muxed with the wrong
+// ratio.
+func TestDeMuxRoundTripCheck(t *testing.T) {
+	input := writeInputs(t, []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05})[0]
+	cycleBits := []int{8, 8}
+	if err := runDeMuxMode(input, "", cycleBits); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDeMuxRoundTrip(input, "", cycleBits); err != nil {
+		t.Errorf("round trip of an aligned input failed: %v", err)
+	}
+
+	// Taking two bytes from stream 0 gives 00 02 01 ..., which first differs from
+	// 00 01 02 ... at bit 14
+	err := checkDeMuxRoundTrip(input, "", []int{16, 8})
+	want := "re-muxed output differs from the input at bit 14 (byte 1)"
+	if err == nil || err.Error() != want {
+		t.Errorf("round trip with the wrong ratio: error = %v, want %q", err, want)
+	}
+}
+
+// TestMaxOpen checks that muxing five inputs of different lengths two at a time
+// gives the same output as keeping them all open, with and without --equalize.
+func TestMaxOpen(t *testing.T) {
+	paths := writeInputs(t,
+		[]byte{0xA1, 0xA2, 0xA3, 0xA4},
+		[]byte{0xB1},
+		[]byte{0xC1, 0xC2, 0xC3},
+		nil,
+		[]byte{0xE1, 0xE2, 0xE3, 0xE4, 0xE5, 0xE6},
+	)
+	dir := filepath.Dir(paths[0])
+	cycleBits := []int{8, 4, 12, 8, 16}
+	for _, equalize := range []bool{false, true} {
+		allOpen := filepath.Join(dir, fmt.Sprintf("all-%v.bin", equalize))
+		batched := filepath.Join(dir, fmt.Sprintf("batched-%v.bin", equalize))
+		if err := runMuxMode(paths, allOpen, cycleBits, equalize, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := runMuxMode(paths, batched, cycleBits, equalize, 2); err != nil {
+			t.Fatal(err)
+		}
+		want, _ := os.ReadFile(allOpen)
+		got, _ := os.ReadFile(batched)
+		if !bytes.Equal(got, want) {
+			t.Errorf("--max-open 2 (equalize %v) = %x, want %x", equalize, got, want)
+		}
+	}
+}
+
+func TestExpandCycles(t *testing.T) {
+	got, err := expandCycles("(0 2 4)(1 3)", 0)
+	if err != nil || got != "2,3,4,1,0" {
+		t.Errorf("expandCycles = %q, %v; want 2,3,4,1,0", got, err)
+	}
+	if got, _ := expandCycles("(0 1)", 4); got != "1,0,2,3" {
+		t.Errorf("expandCycles with fixed points = %q, want 1,0,2,3", got)
+	}
+}
@@ -0,0 +1,1195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/PaulW-NZ/Bit-tools/bitio"
+	"github.com/PaulW-NZ/Bit-tools/internal/outfile"
+)
+
+// outputBitsExact is set from --output-bits-exact and makes closeOutput record
+// the exact number of valid output bits.
+var outputBitsExact bool
+
+// registerForm is how a register is clocked, from --config and --direction.
+type registerForm struct {
+	// galois selects the internal-XOR form for clockRegister.
+	galois bool
+	// shiftLeft makes the register shift toward stage 0, output state[0] and feed
+	// back into the last stage, the mirror image of the default. Seeds and
+	// --state-at output stay in stage order from state[0].
+	shiftLeft bool
+}
+
+// --- Standards Catalog ---
+
+type lfsrStandard struct {
+	name string
+	poly string
+	seed string
+	mode string
+}
+
+var standards = []lfsrStandard{
+	{"prbs7", "7,6", "1111111", "gen"},
+	{"prbs9", "9,5", "111111111", "gen"},
+	{"prbs15", "15,14", "111111111111111", "gen"},
+	{"prbs23", "23,18", "11111111111111111111111", "gen"},
+	{"prbs31", "31,28", "1111111111111111111111111111111", "gen"},
+	// CCSDS pseudo-randomizer h(x) = x^8+x^7+x^5+x^3+1; yields FF 48 0E C0 9A ...
+	{"ccsds", "8,5,3,1", "11111111", "cipher"},
+	// SONET/SDH frame-synchronous scrambler 1+x^6+x^7
+	{"scrambler-sonet", "7,6", "1111111", "cipher"},
+}
+
+func lookupStandard(name string) (lfsrStandard, error) {
+	names := make([]string, len(standards))
+	for i, std := range standards {
+		if std.name == name {
+			return std, nil
+		}
+		names[i] = std.name
+	}
+	return lfsrStandard{}, fmt.Errorf("unknown standard '%s'. Known standards are: %s", name, strings.Join(names, ", "))
+}
+
+// --- Main Logic ---
+
+func main() {
+	mode := flag.String("mode", "gen", "Operating mode: gen, cipher, scramble, descramble, ascramble, adescramble, period, combine")
+	polyStr := flag.String("p", "", "(Required) Polynomial taps, comma-separated (e.g., \"16,14,13,11\")")
+	seedStr := flag.String("s", "", "Initial fill/seed as a binary string, or 0x-prefixed hex (for gen, cipher, ascramble, and adescramble modes).")
+	numBits := flag.Int64("n", 0, "Number of bits to generate (in gen and combine modes), or the most clocks to try (in period mode).")
+	numBytes := flag.Int64("bytes", 0, "Number of whole bytes to generate (in gen mode), instead of -n.")
+	inputFile := flag.String("i", "", "Input file path (for cipher, scramble, descramble, ascramble, adescramble, and combine modes).")
+	outputFile := flag.String("o", "", "Output file path.")
+	summary := flag.Bool("summary", false, "Print the degree, taps, period check, and bit count to stderr when gen mode finishes.")
+	debruijn := flag.Bool("debruijn", false, "Insert one extra zero per period to produce a De Bruijn sequence of 2^degree bits (in gen mode). -n defaults to one period.")
+	invert := flag.Bool("invert", false, "Invert each keystream bit (in gen, cipher, ascramble, and adescramble modes).")
+	alsoReversed := flag.String("also-reversed", "", "Also write the gen output with the bits of each byte reversed to this path (in gen mode).")
+	stateAt := flag.Int64("state-at", -1, "Print the register state after K clocks from the seed as a binary string, instead of running a mode.")
+	showConfig := flag.Bool("show-config", false, "Print the resolved configuration to stderr before processing.")
+	config := flag.String("config", "fibonacci", "Register form: fibonacci (external XOR) or galois (internal XOR).")
+	direction := flag.String("direction", "right", "Shift direction: right (toward the last stage, the default) or left (toward stage 0, output from state[0]).")
+	prbs := flag.Int("prbs", 0, "Use the ITU-T O.150 PRBS polynomial of this degree (7, 9, 15, 23 or 31). -s defaults to all ones.")
+	method := flag.String("method", "shrinking", "How combine mode joins its registers: shrinking, stop-and-go, or alternating.")
+	p1 := flag.String("p1", "", "Taps of register A, the clock controller (in combine mode).")
+	s1 := flag.String("s1", "", "Seed of register A (in combine mode).")
+	p2 := flag.String("p2", "", "Taps of register B (in combine mode).")
+	s2 := flag.String("s2", "", "Seed of register B (in combine mode).")
+	p3 := flag.String("p3", "", "Taps of register C (in combine mode with --method alternating).")
+	s3 := flag.String("s3", "", "Seed of register C (in combine mode with --method alternating).")
+	keystreamOut := flag.String("keystream-out", "", "Also write the raw keystream bits to this path, one per data bit (in cipher, ascramble, and adescramble modes).")
+	reload := flag.Int64("reload", 0, "Reload the seed every N bits, for framed additive scramblers (in cipher, ascramble, and adescramble modes). 0 never reloads.")
+	initStr := flag.String("init", "", "Initial scrambler state as a binary string, or 0x-prefixed hex (for scramble and descramble modes). Defaults to all zeros.")
+	reportSync := flag.Bool("report-sync", false, "Print the bit offset from which the descrambled output matches the --ref file (in descramble mode).")
+	refFile := flag.String("ref", "", "Reference file of the expected plaintext for --report-sync.")
+	verbose := flag.Bool("verbose", false, "Report the polynomial selected by --prbs or --standard on stderr.")
+	standard := flag.String("standard", "", "Use the taps, seed, and mode of a named standard (e.g., prbs7, ccsds). -p, -s, and --mode override it.")
+	noClobberFlag := flag.Bool("no-clobber", false, "Refuse to overwrite existing output files.")
+	exactFlag := flag.Bool("output-bits-exact", false, "Record the exact number of output bits in a <output>.bits file (or on stderr for stdout).")
+	force := flag.Bool("force", false, "Allow overwriting existing output files, overriding --no-clobber.")
+	flag.Parse()
+	outfile.NoClobber = *noClobberFlag && !*force
+	outputBitsExact = *exactFlag
+
+	var form registerForm
+	switch *config {
+	case "fibonacci":
+	case "galois":
+		form.galois = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --config must be fibonacci or galois, got '%s'.\n", *config)
+		os.Exit(1)
+	}
+	switch *direction {
+	case "right":
+	case "left":
+		form.shiftLeft = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --direction must be left or right, got '%s'.\n", *direction)
+		os.Exit(1)
+	}
+	if form.galois && *debruijn {
+		fmt.Fprintln(os.Stderr, "Error: --debruijn is only supported with --config fibonacci.")
+		os.Exit(1)
+	}
+
+	if *standard != "" {
+		std, err := lookupStandard(*standard)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		setFlags := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+		if !setFlags["p"] {
+			*polyStr = std.poly
+		}
+		if !setFlags["s"] {
+			*seedStr = std.seed
+		}
+		if !setFlags["mode"] {
+			*mode = std.mode
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Using standard %s: taps %s\n", std.name, std.poly)
+		}
+	}
+
+	if *prbs != 0 {
+		if *polyStr != "" || *standard != "" {
+			fmt.Fprintln(os.Stderr, "Error: --prbs cannot be combined with -p or --standard.")
+			os.Exit(1)
+		}
+		std, err := lookupStandard(fmt.Sprintf("prbs%d", *prbs))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --prbs must be 7, 9, 15, 23 or 31, got %d.\n", *prbs)
+			os.Exit(1)
+		}
+		*polyStr = std.poly
+		if *seedStr == "" {
+			*seedStr = std.seed
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Using PRBS%d (ITU-T O.150): taps %s\n", *prbs, std.poly)
+		}
+	}
+
+	if *numBytes != 0 {
+		if *numBits != 0 {
+			fmt.Fprintln(os.Stderr, "Error: -n and --bytes cannot be used together.")
+			os.Exit(1)
+		}
+		if *mode != "gen" {
+			fmt.Fprintln(os.Stderr, "Error: --bytes is only supported in gen mode.")
+			os.Exit(1)
+		}
+		if *numBytes < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --bytes must be positive, got %d.\n", *numBytes)
+			os.Exit(1)
+		}
+		*numBits = *numBytes * 8
+	}
+
+	if *showConfig {
+		degree := 0
+		if _, d, err := parsePoly(*polyStr); err == nil && *polyStr != "" {
+			degree = d
+		}
+		fmt.Fprintf(os.Stderr, "Config: mode=%s config=%s direction=%s taps=%s degree=%d seed=%s bits=%d invert=%t input=%q output=%q\n",
+			*mode, *config, *direction, *polyStr, degree, *seedStr, *numBits, *invert, *inputFile, *outputFile)
+	}
+
+	if *reload < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --reload must not be negative, got %d.\n", *reload)
+		os.Exit(1)
+	}
+	if *reportSync && *refFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: --report-sync requires --ref.")
+		os.Exit(1)
+	}
+
+	if *stateAt >= 0 {
+		if err := runStateAt(os.Stdout, *polyStr, *seedStr, *stateAt, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in --state-at: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch *mode {
+	case "gen":
+		if err := runGenMode(*polyStr, *seedStr, *numBits, *outputFile, *alsoReversed, *invert, *summary, *debruijn, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in gen mode: %v\n", err)
+			os.Exit(1)
+		}
+	case "cipher":
+		if err := runCipherMode(*polyStr, *seedStr, *inputFile, *outputFile, *keystreamOut, *invert, *reload, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in cipher mode: %v\n", err)
+			os.Exit(1)
+		}
+	case "scramble":
+		if err := runScrambleMode(*polyStr, *initStr, *inputFile, *outputFile, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in scramble mode: %v\n", err)
+			os.Exit(1)
+		}
+	case "descramble":
+		if err := runDescrambleMode(*polyStr, *initStr, *inputFile, *outputFile, *refFile, *reportSync, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in descramble mode: %v\n", err)
+			os.Exit(1)
+		}
+	case "ascramble", "adescramble":
+		if err := runAdditiveScrambleMode(*mode, *polyStr, *seedStr, *inputFile, *outputFile, *keystreamOut, *invert, *reload, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in %s mode: %v\n", *mode, err)
+			os.Exit(1)
+		}
+	case "combine":
+		polys := []string{*p1, *p2, *p3}
+		seeds := []string{*s1, *s2, *s3}
+		if err := runCombineMode(*method, polys, seeds, *numBits, *inputFile, *outputFile, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in combine mode: %v\n", err)
+			os.Exit(1)
+		}
+	case "period":
+		if err := runPeriodMode(*polyStr, *seedStr, *numBits, form); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in period mode: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown mode '%s'. Valid modes are: gen, cipher, scramble, descramble, ascramble, adescramble, period, combine.\n", *mode)
+		os.Exit(1)
+	}
+}
+
+// --- Mode 1: Generate Sequence ---
+func runGenMode(polyStr, seedStr string, numBits int64, outputFilePath, reversedFilePath string, invert, summary, debruijn bool, form registerForm) error {
+	if polyStr == "" || seedStr == "" || (numBits <= 0 && !debruijn) {
+		return errors.New("-p, -s, and -n or --bytes are required for gen mode")
+	}
+
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return err
+	}
+
+	state, err := parseSeed(seedStr, degree)
+	if err != nil {
+		return err
+	}
+
+	if len(state) != degree {
+		return fmt.Errorf("seed length (%d) must match the polynomial degree (%d)", len(state), degree)
+	}
+	seed := append([]byte(nil), state...)
+
+	if debruijn {
+		if degree > maxPeriodCheckDegree {
+			return fmt.Errorf("--debruijn supports degrees up to %d, got %d", maxPeriodCheckDegree, degree)
+		}
+		maxPeriod := (int64(1) << uint(degree)) - 1
+		if period := measurePeriod(poly, degree, seed, maxPeriod+1, form); period != maxPeriod {
+			return fmt.Errorf("--debruijn needs a maximal-length polynomial and a non-zero seed; the period is %d, not %d", period, maxPeriod)
+		}
+		if numBits <= 0 {
+			numBits = maxPeriod + 1
+		}
+	}
+
+	if numBits%8 != 0 {
+		fmt.Fprintf(os.Stderr, "Note: %d bits is not a whole number of bytes; the final byte is zero-padded.\n", numBits)
+	}
+
+	var writer io.Writer = os.Stdout
+	if outputFilePath != "" && outputFilePath != "-" {
+		file, err := outfile.Create(outputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	bitWriter := bitio.NewWriter(writer)
+
+	insertedZero := false
+
+	// The reversed output gets the same bits packed least significant bit first.
+	var reversedWriter *bitio.Writer
+	if reversedFilePath != "" {
+		file, err := outfile.Create(reversedFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reversedWriter = bitio.NewWriterOrder(file, bitio.LSBFirst)
+	}
+
+	if !debruijn && degree <= 64 {
+		// Fast path: clock a word-sized register and emit whole bytes.
+		if err := generatePacked(poly, degree, state, numBits, invert, bitWriter, reversedWriter, form); err != nil {
+			return err
+		}
+	} else {
+		for i := int64(0); i < numBits; i++ {
+			outputBit := outputStage(state, form)
+			if debruijn && !insertedZero && isZeroRunStart(state, form) {
+				// Lengthen the run of degree-1 zeros to degree zeros, adding the all-zero
+				// window the register never visits. The register is not clocked for it.
+				outputBit = 0
+				insertedZero = true
+			} else {
+				insertedZero = false
+			}
+			if invert {
+				outputBit ^= 1
+			}
+			if err := bitWriter.Write([]byte{outputBit}); err != nil {
+				return err
+			}
+			if reversedWriter != nil {
+				if err := reversedWriter.Write([]byte{outputBit}); err != nil {
+					return err
+				}
+			}
+
+			if insertedZero {
+				continue
+			}
+
+			clockRegister(state, poly, form)
+		}
+	}
+
+	if reversedWriter != nil {
+		if err := closeOutput(reversedWriter, reversedFilePath); err != nil {
+			return err
+		}
+	}
+
+	if err := closeOutput(bitWriter, outputFilePath); err != nil {
+		return err
+	}
+	if summary {
+		printGenSummary(os.Stderr, poly, degree, seed, numBits, form)
+	}
+	return nil
+}
+
+// generatePacked produces the same bits as the serial loop in runGenMode, holding
+// the register in a uint64 (bit i is stage i+1) and writing eight output bits at a
+// time. The reversed output, if any, gets each byte with its bits reversed.
+func generatePacked(poly []int, degree int, seed []byte, numBits int64, invert bool, out, reversed *bitio.Writer, form registerForm) error {
+	var reg, tapMask uint64
+	for i, bit := range seed {
+		reg |= uint64(bit) << uint(i)
+	}
+	for _, tap := range poly {
+		if form.galois {
+			tapMask ^= 1 << uint(galoisStage(degree, tap, form))
+		} else {
+			tapMask ^= 1 << uint(tapStage(degree, tap, form))
+		}
+	}
+	mask := ^uint64(0) >> uint(64-degree)
+	top := uint(degree - 1)
+
+	next := func() byte {
+		var outputBit byte
+		switch {
+		case form.galois && form.shiftLeft:
+			outputBit = byte(reg) & 1
+			reg >>= 1
+			if outputBit == 1 {
+				reg ^= tapMask
+			}
+		case form.galois:
+			outputBit = byte(reg>>top) & 1
+			reg = (reg << 1) & mask
+			if outputBit == 1 {
+				reg ^= tapMask
+			}
+		case form.shiftLeft:
+			outputBit = byte(reg) & 1
+			reg = reg>>1 | uint64(bits.OnesCount64(reg&tapMask)&1)<<top
+		default:
+			outputBit = byte(reg>>top) & 1
+			reg = (reg<<1)&mask | uint64(bits.OnesCount64(reg&tapMask)&1)
+		}
+		if invert {
+			outputBit ^= 1
+		}
+		return outputBit
+	}
+
+	for n := numBits / 8; n > 0; n-- {
+		b := byte(0)
+		for k := 0; k < 8; k++ {
+			b = b<<1 | next()
+		}
+		if err := out.WriteByte(b); err != nil {
+			return err
+		}
+		if reversed != nil {
+			if err := reversed.WriteByte(bits.Reverse8(b)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Close pads the last partial byte of both outputs.
+	tail := make([]byte, numBits%8)
+	for k := range tail {
+		tail[k] = next()
+	}
+	if err := out.Write(tail); err != nil {
+		return err
+	}
+	if reversed != nil {
+		return reversed.Write(tail)
+	}
+	return nil
+}
+
+// isZeroRunStart reports whether the next outputs are degree-1 zeros followed by a
+// one, the state at which --debruijn inserts its extra zero. The register holds its
+// next degree outputs, ending with the stage the feedback last entered.
+func isZeroRunStart(state []byte, form registerForm) bool {
+	first, rest := 0, state[1:]
+	if form.shiftLeft {
+		first, rest = len(state)-1, state[:len(state)-1]
+	}
+	if state[first] != 1 {
+		return false
+	}
+	for _, bit := range rest {
+		if bit != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxPeriodCheckDegree bounds the register size for which the period is simulated.
+const maxPeriodCheckDegree = 24
+
+// printGenSummary prints the register size, whether it is maximal and the number
+// of bits generated to w.
+func printGenSummary(w io.Writer, poly []int, degree int, seed []byte, numBits int64, form registerForm) {
+	fmt.Fprintln(w, "Summary:")
+	fmt.Fprintf(w, "  Degree:         %d\n", degree)
+	fmt.Fprintf(w, "  Taps:           %d\n", len(poly))
+	if degree <= maxPeriodCheckDegree {
+		maxPeriod := (int64(1) << uint(degree)) - 1
+		period := measurePeriod(poly, degree, seed, maxPeriod+1, form)
+		maximal := "no"
+		if period == maxPeriod {
+			maximal = "yes"
+		}
+		fmt.Fprintf(w, "  Period:         %d (maximal %d)\n", period, maxPeriod)
+		fmt.Fprintf(w, "  Primitive:      %s\n", maximal)
+	} else {
+		fmt.Fprintf(w, "  Primitive:      not checked (degree > %d)\n", maxPeriodCheckDegree)
+	}
+	fmt.Fprintf(w, "  Bits generated: %d\n", numBits)
+}
+
+// measurePeriod clocks the register from seed until it returns to seed and returns
+// the number of steps taken, or 0 if it has not returned within limit steps.
+func measurePeriod(poly []int, degree int, seed []byte, limit int64, form registerForm) int64 {
+	state := append([]byte(nil), seed...)
+	for step := int64(1); step <= limit; step++ {
+		clockRegister(state, poly, form)
+
+		same := true
+		for i := range state {
+			if state[i] != seed[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return step
+		}
+	}
+	return 0
+}
+
+// defaultPeriodLimit is how many clocks period mode tries for registers above
+// maxPeriodCheckDegree when -n does not set a limit.
+const defaultPeriodLimit = int64(1) << 28
+
+// --- Mode 5: Period Check ---
+// runPeriodMode clocks the register from the seed until it returns to the seed and
+// reports the cycle length, warning when it falls short of the maximal 2^degree-1.
+func runPeriodMode(polyStr, seedStr string, limit int64, form registerForm) error {
+	if polyStr == "" || seedStr == "" {
+		return errors.New("-p and -s are required for period mode")
+	}
+
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return err
+	}
+
+	seed, err := parseSeed(seedStr, degree)
+	if err != nil {
+		return err
+	}
+
+	if len(seed) != degree {
+		return fmt.Errorf("seed length (%d) must match the polynomial degree (%d)", len(seed), degree)
+	}
+
+	maxPeriod := (int64(1) << uint(degree)) - 1
+	if limit <= 0 {
+		limit = defaultPeriodLimit
+		if degree <= maxPeriodCheckDegree {
+			limit = maxPeriod + 1
+		}
+	}
+
+	period := measurePeriod(poly, degree, seed, limit, form)
+	if period == 0 {
+		fmt.Printf("Period: at least %d (stopped after %d clocks; maximal %d)\n", limit, limit, maxPeriod)
+		return nil
+	}
+	fmt.Printf("Period: %d (maximal %d)\n", period, maxPeriod)
+	if period < maxPeriod {
+		fmt.Fprintf(os.Stderr, "Warning: the period %d is shorter than the maximal %d; the taps are not primitive or the seed is all zeros.\n", period, maxPeriod)
+	}
+	return nil
+}
+
+// runStateAt clocks the register the given number of steps from the seed and prints
+// the state to w in the same bit order as the -s seed string.
+func runStateAt(w io.Writer, polyStr, seedStr string, steps int64, form registerForm) error {
+	if polyStr == "" || seedStr == "" {
+		return errors.New("-p and -s are required with --state-at")
+	}
+
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return err
+	}
+
+	state, err := parseSeed(seedStr, degree)
+	if err != nil {
+		return err
+	}
+
+	if len(state) != degree {
+		return fmt.Errorf("seed length (%d) must match the polynomial degree (%d)", len(state), degree)
+	}
+
+	for i := int64(0); i < steps; i++ {
+		clockRegister(state, poly, form)
+	}
+
+	var sb strings.Builder
+	for _, bit := range state {
+		sb.WriteByte('0' + bit)
+	}
+	fmt.Fprintln(w, sb.String())
+	return nil
+}
+
+// clockRegister advances the register one step. The output bit is the last stage,
+// state[degree-1], or state[0] with --direction left. In the Fibonacci (external-XOR)
+// form the tapped stages are XORed into a single feedback bit that enters stage 1
+// (the last stage when shifting left). In the Galois (internal-XOR) form the output
+// bit enters stage 1 and is XORed into the stage after each other tap, so tap t of a
+// degree n register toggles state[n-t] as it shifts (state[t-1] when shifting left).
+func clockRegister(state []byte, poly []int, form registerForm) {
+	degree := len(state)
+	if form.galois {
+		outputBit := outputStage(state, form)
+		shiftIn(state, 0, form)
+		for _, tap := range poly {
+			state[galoisStage(degree, tap, form)] ^= outputBit
+		}
+		return
+	}
+	feedbackBit := byte(0)
+	for _, tap := range poly {
+		feedbackBit ^= state[tapStage(degree, tap, form)]
+	}
+	shiftIn(state, feedbackBit, form)
+}
+
+// outputStage returns the register's output bit: the last stage, or state[0] with
+// --direction left.
+func outputStage(state []byte, form registerForm) byte {
+	if form.shiftLeft {
+		return state[0]
+	}
+	return state[len(state)-1]
+}
+
+// shiftIn shifts the register one stage away from its input end and puts bit there:
+// state[0] by default, the last stage with --direction left.
+func shiftIn(state []byte, bit byte, form registerForm) {
+	degree := len(state)
+	if form.shiftLeft {
+		copy(state[:degree-1], state[1:])
+		state[degree-1] = bit
+		return
+	}
+	copy(state[1:], state[:degree-1])
+	state[0] = bit
+}
+
+// tapStage returns the stage that tap t reads for the feedback bit, t-1 stages from
+// the input end. Tap degree is therefore always the output stage.
+func tapStage(degree, tap int, form registerForm) int {
+	if form.shiftLeft {
+		return degree - tap
+	}
+	return tap - 1
+}
+
+// galoisStage returns the stage that tap t toggles in the Galois form, the mirror
+// of tapStage.
+func galoisStage(degree, tap int, form registerForm) int {
+	return degree - 1 - tapStage(degree, tap, form)
+}
+
+// --- Mode 2: Stream Cipher ---
+func runCipherMode(polyStr, seedStr, inputFilePath, outputFilePath, keystreamFilePath string, invert bool, reload int64, form registerForm) error {
+	if polyStr == "" || seedStr == "" {
+		return errors.New("-p and -s are required for cipher mode")
+	}
+
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return err
+	}
+
+	state, err := parseSeed(seedStr, degree)
+	if err != nil {
+		return err
+	}
+
+	if len(state) != degree {
+		return fmt.Errorf("seed length (%d) must match the polynomial degree (%d)", len(state), degree)
+	}
+	seed := append([]byte(nil), state...)
+
+	var reader io.Reader = os.Stdin
+	if inputFilePath != "" && inputFilePath != "-" {
+		file, err := os.Open(inputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	bitReader := bitio.NewReader(reader)
+
+	var writer io.Writer = os.Stdout
+	if outputFilePath != "" && outputFilePath != "-" {
+		file, err := outfile.Create(outputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	bitWriter := bitio.NewWriter(writer)
+
+	// The keystream copy gets one bit per data bit, so the two files line up.
+	var keystreamWriter *bitio.Writer
+	if keystreamFilePath != "" {
+		file, err := outfile.Create(keystreamFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		keystreamWriter = bitio.NewWriter(file)
+	}
+
+	for count := int64(0); ; count++ {
+		dataBitSlice, err := bitReader.Read(1)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if len(dataBitSlice) == 0 {
+			break
+		}
+		dataBit := dataBitSlice[0]
+
+		// Framed scramblers restart the keystream from the seed at each frame.
+		if reload > 0 && count > 0 && count%reload == 0 {
+			copy(state, seed)
+		}
+
+		keystreamBit := outputStage(state, form)
+		if invert {
+			keystreamBit ^= 1
+		}
+
+		clockRegister(state, poly, form)
+
+		outputBit := dataBit ^ keystreamBit
+
+		if err := bitWriter.Write([]byte{outputBit}); err != nil {
+			return err
+		}
+		if keystreamWriter != nil {
+			if err := keystreamWriter.Write([]byte{keystreamBit}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if keystreamWriter != nil {
+		if err := closeOutput(keystreamWriter, keystreamFilePath); err != nil {
+			return err
+		}
+	}
+	return closeOutput(bitWriter, outputFilePath)
+}
+
+// --- Modes 3a/4a: Additive Scrambler ---
+// runAdditiveScrambleMode XORs the data with a free-running keystream that does
+// not depend on the data, as in cipher mode. Scrambling and descrambling are the
+// same operation, so both modes share it.
+func runAdditiveScrambleMode(mode, polyStr, seedStr, inputFilePath, outputFilePath, keystreamFilePath string, invert bool, reload int64, form registerForm) error {
+	if polyStr == "" || seedStr == "" {
+		return fmt.Errorf("-p and -s are required for %s mode", mode)
+	}
+	return runCipherMode(polyStr, seedStr, inputFilePath, outputFilePath, keystreamFilePath, invert, reload, form)
+}
+
+// --- Mode 3: Feed-Through Scrambler ---
+func runScrambleMode(polyStr, initStr, inputFilePath, outputFilePath string, form registerForm) error {
+	if polyStr == "" {
+		return errors.New("-p is required for scramble mode")
+	}
+
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return err
+	}
+
+	state, err := scramblerState(initStr, degree)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = os.Stdin
+	if inputFilePath != "" && inputFilePath != "-" {
+		file, err := os.Open(inputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	bitReader := bitio.NewReader(reader)
+
+	var writer io.Writer = os.Stdout
+	if outputFilePath != "" && outputFilePath != "-" {
+		file, err := outfile.Create(outputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	bitWriter := bitio.NewWriter(writer)
+
+	for {
+		dataBitSlice, err := bitReader.Read(1)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if len(dataBitSlice) == 0 {
+			break
+		}
+		dataBit := dataBitSlice[0]
+
+		// 1. Calculate feedback from current state
+		feedbackBit := byte(0)
+		for _, tap := range poly {
+			feedbackBit ^= state[tapStage(degree, tap, form)]
+		}
+
+		// 2. XOR data with feedback to create the output bit
+		outputBit := dataBit ^ feedbackBit
+
+		// 3. Shift register, feeding in the scrambled output bit
+		shiftIn(state, outputBit, form) // LFSR is fed by its own output
+
+		// 4. Write the result
+		if err := bitWriter.Write([]byte{outputBit}); err != nil {
+			return err
+		}
+	}
+
+	return closeOutput(bitWriter, outputFilePath)
+}
+
+// --- Mode 4: Feed-Through Descrambler ---
+func runDescrambleMode(polyStr, initStr, inputFilePath, outputFilePath, refFilePath string, reportSync bool, form registerForm) error {
+	if polyStr == "" {
+		return errors.New("-p is required for descramble mode")
+	}
+
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return err
+	}
+
+	state, err := scramblerState(initStr, degree)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = os.Stdin
+	if inputFilePath != "" && inputFilePath != "-" {
+		file, err := os.Open(inputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	bitReader := bitio.NewReader(reader)
+
+	var writer io.Writer = os.Stdout
+	if outputFilePath != "" && outputFilePath != "-" {
+		file, err := outfile.Create(outputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	bitWriter := bitio.NewWriter(writer)
+
+	var refReader *bitio.Reader
+	if reportSync {
+		file, err := os.Open(refFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		refReader = bitio.NewReader(file)
+	}
+	// compared counts the output bits checked against the reference; lastMismatch
+	// is the offset of the last one that differed, or -1.
+	compared, lastMismatch := int64(0), int64(-1)
+
+	for {
+		dataBitSlice, err := bitReader.Read(1)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if len(dataBitSlice) == 0 {
+			break
+		}
+		dataBit := dataBitSlice[0]
+
+		// 1. Calculate feedback from current state
+		feedbackBit := byte(0)
+		for _, tap := range poly {
+			feedbackBit ^= state[tapStage(degree, tap, form)]
+		}
+
+		// 2. XOR data with feedback to create the output bit (descrambled data)
+		outputBit := dataBit ^ feedbackBit
+
+		// 3. Shift register, feeding in the *input* to the descrambler (scrambled data)
+		shiftIn(state, dataBit, form) // LFSR is fed by the scrambled input
+
+		// 4. Write the result
+		if err := bitWriter.Write([]byte{outputBit}); err != nil {
+			return err
+		}
+
+		if refReader != nil {
+			refBit, err := refReader.Read(1)
+			if err == nil {
+				if refBit[0] != outputBit {
+					lastMismatch = compared
+				}
+				compared++
+			} else if err == io.EOF {
+				refReader = nil
+			} else {
+				return err
+			}
+		}
+	}
+
+	if reportSync {
+		reportSyncOffset(compared, lastMismatch, degree)
+	}
+	return closeOutput(bitWriter, outputFilePath)
+}
+
+// reportSyncOffset prints the bit offset from which the descrambled output
+// matched the reference through to the end of the comparison.
+func reportSyncOffset(compared, lastMismatch int64, degree int) {
+	switch {
+	case compared == 0:
+		fmt.Fprintln(os.Stderr, "Sync: no bits compared (the reference file is empty).")
+	case lastMismatch == compared-1:
+		fmt.Fprintf(os.Stderr, "Sync: not reached; output still differs from the reference at bit %d of %d.\n", lastMismatch, compared)
+	default:
+		fmt.Fprintf(os.Stderr, "Sync: output matches the reference from bit %d (of %d compared, degree %d).\n", lastMismatch+1, compared, degree)
+	}
+}
+
+// scramblerState returns the initial scrambler register: all zeros, or the
+// --init value, which must be exactly degree bits long.
+func scramblerState(initStr string, degree int) ([]byte, error) {
+	if initStr == "" {
+		return make([]byte, degree), nil
+	}
+	state, err := parseSeed(initStr, degree)
+	if err != nil {
+		return nil, err
+	}
+	if len(state) != degree {
+		return nil, fmt.Errorf("--init length (%d) must match the polynomial degree (%d)", len(state), degree)
+	}
+	return state, nil
+}
+
+// --- Mode 7: Combined Generators ---
+
+// register is one LFSR of a combined generator.
+type register struct {
+	poly  []int
+	state []byte
+	form  registerForm
+}
+
+func newRegister(name, polyStr, seedStr string, form registerForm) (*register, error) {
+	if polyStr == "" || seedStr == "" {
+		return nil, fmt.Errorf("register %s needs taps and a seed", name)
+	}
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		return nil, fmt.Errorf("register %s: %v", name, err)
+	}
+	state, err := parseSeed(seedStr, degree)
+	if err != nil {
+		return nil, fmt.Errorf("register %s: %v", name, err)
+	}
+	if len(state) != degree {
+		return nil, fmt.Errorf("register %s: seed length (%d) must match the polynomial degree (%d)", name, len(state), degree)
+	}
+	return &register{poly: poly, state: state, form: form}, nil
+}
+
+// output returns the register's current output bit.
+func (r *register) output() byte {
+	return outputStage(r.state, r.form)
+}
+
+// step returns the output bit and clocks the register.
+func (r *register) step() byte {
+	bit := r.output()
+	clockRegister(r.state, r.poly, r.form)
+	return bit
+}
+
+// runCombineMode joins registers A and B (and C for alternating) into one
+// keystream. With -i the keystream is XORed with the input as in cipher mode;
+// otherwise -n keystream bits are written.
+//   - shrinking: clock A and B together and emit B's bit only when A's bit is 1.
+//   - stop-and-go: clock A, clock B only when A's bit is 1, and emit B's output.
+//   - alternating: clock A, then clock B when A's bit is 1 or C when it is 0, and
+//     emit the XOR of B's and C's outputs.
+func runCombineMode(method string, polys, seeds []string, numBits int64, inputFilePath, outputFilePath string, form registerForm) error {
+	names := []string{"A (--p1/--s1)", "B (--p2/--s2)", "C (--p3/--s3)"}
+	count := 2
+	switch method {
+	case "shrinking", "stop-and-go":
+	case "alternating":
+		count = 3
+	default:
+		return fmt.Errorf("--method must be shrinking, stop-and-go, or alternating, got '%s'", method)
+	}
+	if count == 2 && (polys[2] != "" || seeds[2] != "") {
+		return fmt.Errorf("--p3 and --s3 are only used with --method alternating")
+	}
+	regs := make([]*register, count)
+	for i := range regs {
+		reg, err := newRegister(names[i], polys[i], seeds[i], form)
+		if err != nil {
+			return err
+		}
+		regs[i] = reg
+	}
+	a, b := regs[0], regs[1]
+	if method == "shrinking" && bytes.IndexByte(a.state, 1) < 0 {
+		// An all-zero controller never outputs a 1, so nothing would be emitted.
+		return errors.New("register A needs a non-zero seed for the shrinking generator")
+	}
+
+	next := func() byte {
+		switch method {
+		case "shrinking":
+			for {
+				control := a.step()
+				bit := b.step()
+				if control == 1 {
+					return bit
+				}
+			}
+		case "stop-and-go":
+			if a.step() == 1 {
+				b.step()
+			}
+			return b.output()
+		default:
+			c := regs[2]
+			if a.step() == 1 {
+				b.step()
+			} else {
+				c.step()
+			}
+			return b.output() ^ c.output()
+		}
+	}
+
+	var bitReader *bitio.Reader
+	if inputFilePath != "" {
+		var reader io.Reader = os.Stdin
+		if inputFilePath != "-" {
+			file, err := os.Open(inputFilePath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			reader = file
+		}
+		bitReader = bitio.NewReader(reader)
+	} else if numBits <= 0 {
+		return errors.New("-n or -i is required for combine mode")
+	}
+
+	var writer io.Writer = os.Stdout
+	if outputFilePath != "" && outputFilePath != "-" {
+		file, err := outfile.Create(outputFilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	bitWriter := bitio.NewWriter(writer)
+
+	for i := int64(0); bitReader != nil || i < numBits; i++ {
+		outputBit := next()
+		if bitReader != nil {
+			dataBitSlice, err := bitReader.Read(1)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			outputBit ^= dataBitSlice[0]
+		}
+		if err := bitWriter.Write([]byte{outputBit}); err != nil {
+			return err
+		}
+	}
+
+	return closeOutput(bitWriter, outputFilePath)
+}
+
+// --- Helper Functions ---
+
+func parsePoly(polyStr string) (taps []int, degree int, err error) {
+	parts := strings.Split(polyStr, ",")
+	if len(parts) == 0 {
+		return nil, 0, errors.New("polynomial cannot be empty")
+	}
+
+	for _, p := range parts {
+		tap, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid tap value: %s", p)
+		}
+		if tap == 0 {
+			// The x^0 term is always present in the feedback polynomial and has no register stage.
+			fmt.Fprintln(os.Stderr, "Warning: ignoring tap 0 (the implicit x^0 term).")
+			continue
+		}
+		if tap < 0 {
+			return nil, 0, fmt.Errorf("tap values must be positive: %d", tap)
+		}
+		taps = append(taps, tap)
+	}
+	if len(taps) == 0 {
+		return nil, 0, errors.New("polynomial must contain at least one non-zero tap")
+	}
+
+	degree = 0
+	for _, tap := range taps {
+		if tap > degree {
+			degree = tap
+		}
+	}
+
+	return taps, degree, nil
+}
+
+// closeOutput flushes bw and, with --output-bits-exact, records how many of the
+// bits written to path are valid.
+func closeOutput(bw *bitio.Writer, path string) error {
+	if err := bw.Close(); err != nil {
+		return err
+	}
+	if outputBitsExact {
+		return outfile.ReportExactBits(path, bw.Written())
+	}
+	return nil
+}
+
+// parseSeed reads a seed in stage order, from state[0], in either shift direction.
+func parseSeed(seedStr string, degree int) ([]byte, error) {
+	if strings.HasPrefix(seedStr, "0x") || strings.HasPrefix(seedStr, "0X") {
+		return parseHexSeed(seedStr, degree)
+	}
+	seed := make([]byte, len(seedStr))
+	for i, char := range seedStr {
+		if char == '1' {
+			seed[i] = 1
+		} else if char == '0' {
+			seed[i] = 0
+		} else {
+			return nil, fmt.Errorf("invalid character in seed string: %c", char)
+		}
+	}
+	return seed, nil
+}
+
+// parseHexSeed expands a 0x-prefixed seed to degree bits, most significant bit first
+// like a binary seed, so 0x5 and "0101" give the same register for degree 4.
+func parseHexSeed(seedStr string, degree int) ([]byte, error) {
+	digits := seedStr[2:]
+	if digits == "" {
+		return nil, fmt.Errorf("hex seed %s has no digits", seedStr)
+	}
+	bits := make([]byte, 0, 4*len(digits))
+	for _, char := range digits {
+		value, err := strconv.ParseUint(string(char), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid character in hex seed: %c", char)
+		}
+		for shift := 3; shift >= 0; shift-- {
+			bits = append(bits, byte(value>>uint(shift))&1)
+		}
+	}
+	for len(bits) > degree {
+		if bits[0] != 0 {
+			return nil, fmt.Errorf("hex seed %s does not fit in the polynomial degree (%d bits)", seedStr, degree)
+		}
+		bits = bits[1:]
+	}
+	seed := make([]byte, degree-len(bits), degree)
+	return append(seed, bits...), nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PaulW-NZ/Bit-tools/bitio"
+)
+
+// wikipediaSeed is 0xACE1 in stage order, state[0] being its least significant bit,
+// for the 16-bit example LFSRs in Wikipedia's "Linear-feedback shift register".
+const wikipediaSeed = "1000011100110101"
+
+// generate returns numBits of gen output from both the packed generator and the
+// serial clockRegister loop.
+func generate(t *testing.T, polyStr, seedStr string, numBits int, form registerForm) (packed, serial []byte) {
+	poly, degree, err := parsePoly(polyStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := parseSeed(seedStr, degree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	bw := bitio.NewWriter(&out)
+	if err := generatePacked(poly, degree, seed, int64(numBits), false, bw, nil, form); err != nil {
+		t.Fatal(err)
+	}
+	bw.Close()
+
+	state := append([]byte(nil), seed...)
+	bits := make([]byte, numBits)
+	for i := range bits {
+		bits[i] = outputStage(state, form)
+		clockRegister(state, poly, form)
+	}
+	return out.Bytes(), bitio.BitsToBytes(bits)
+}
+
+// TestLeftDirection checks --direction left against the Fibonacci (bits 0, 2, 3
+// and 5 XORed into bit 15) and Galois (toggle mask 0xB400) examples, which shift
+// toward bit 0 and output bit 0.
+func TestLeftDirection(t *testing.T) {
+	tests := []struct {
+		name string
+		form registerForm
+		want string
+	}{
+		{"left fibonacci", registerForm{shiftLeft: true}, "873544e2ec23b9c7"},
+		{"left galois", registerForm{galois: true, shiftLeft: true}, "872346dcb0ddeef8"},
+		{"right fibonacci", registerForm{}, "ace1e455dd17e30b"},
+	}
+	for _, tt := range tests {
+		packed, serial := generate(t, "16,14,13,11", wikipediaSeed, 64, tt.form)
+		if hex.EncodeToString(packed) != tt.want {
+			t.Errorf("%s: packed output %x, want %s", tt.name, packed, tt.want)
+		}
+		if !bytes.Equal(packed, serial) {
+			t.Errorf("%s: packed output %x differs from serial %x", tt.name, packed, serial)
+		}
+	}
+
+	left := registerForm{shiftLeft: true}
+	poly, degree, _ := parsePoly("16,14,13,11")
+	seed, _ := parseSeed(wikipediaSeed, degree)
+	state := append([]byte(nil), seed...)
+	clockRegister(state, poly, left)
+	// 0xACE1 >> 1 with a 0 fed back is 0x5670
+	if got := bitsString(state); got != "0000111001101010" {
+		t.Errorf("state after one clock = %s, want 0000111001101010", got)
+	}
+	if period := measurePeriod(poly, degree, seed, 1<<17, left); period != 65535 {
+		t.Errorf("period = %d, want 65535", period)
+	}
+}
+
+// TestScrambleRoundTrip runs a file through the feed-through scrambler and back in
+// both directions.
+func TestScrambleRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	scrambled := filepath.Join(dir, "scrambled")
+	output := filepath.Join(dir, "output")
+	data := bytes.Repeat([]byte{0xB1, 0x0F, 0x5A, 0xC3}, 16)
+	if err := os.WriteFile(input, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, left := range []bool{false, true} {
+		form := registerForm{shiftLeft: left}
+		if err := runScrambleMode("7,4", "0x5A", input, scrambled, form); err != nil {
+			t.Fatal(err)
+		}
+		if err := runDescrambleMode("7,4", "0x5A", scrambled, output, "", false, form); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := os.ReadFile(output)
+		if !bytes.Equal(got, data) {
+			t.Errorf("left=%t: round trip gave %x, want %x", left, got, data)
+		}
+	}
+}
+
+// TestParsePolyTapZero checks that tap 0, the implicit x^0 term, is ignored
+// rather than indexing stage -1, and that a polynomial of only tap 0 is an error.
+func TestParsePolyTapZero(t *testing.T) {
+	taps, degree, err := parsePoly("16,14,13,11,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taps) != 4 || degree != 16 {
+		t.Errorf("parsePoly(16,14,13,11,0) = %v, degree %d; want taps 16,14,13,11, degree 16", taps, degree)
+	}
+	withZero, _ := generate(t, "16,14,13,11,0", wikipediaSeed, 64, registerForm{})
+	without, _ := generate(t, "16,14,13,11", wikipediaSeed, 64, registerForm{})
+	if !bytes.Equal(withZero, without) {
+		t.Errorf("output with tap 0 = %x, want %x", withZero, without)
+	}
+	if _, _, err := parsePoly("0"); err == nil || err.Error() != "polynomial must contain at least one non-zero tap" {
+		t.Errorf("parsePoly(0) error = %v, want a clear error", err)
+	}
+}
+
+// runGen runs gen mode with the default register form into temporary files and
+// returns the output and the --also-reversed copy.
+func runGen(t *testing.T, polyStr, seedStr string, numBits int64, invert, debruijn bool) (out, reversed []byte) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "out")
+	reversedPath := filepath.Join(dir, "reversed")
+	if err := runGenMode(polyStr, seedStr, numBits, outPath, reversedPath, invert, false, debruijn, registerForm{}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed, err = os.ReadFile(reversedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, reversed
+}
+
+// TestAlsoReversed checks that the --also-reversed file is the gen output with the
+// bits of each byte reversed.
+func TestAlsoReversed(t *testing.T) {
+	out, reversed := runGen(t, "16,14,13,11", wikipediaSeed, 128, false, false)
+	if len(reversed) != len(out) {
+		t.Fatalf("reversed output has %d bytes, want %d", len(reversed), len(out))
+	}
+	for i := range out {
+		if reversed[i] != bits.Reverse8(out[i]) {
+			t.Errorf("byte %d: reversed %08b, want %08b from %08b", i, reversed[i], bits.Reverse8(out[i]), out[i])
+		}
+	}
+}
+
+// TestInvert checks that --invert gen output is the complement of the normal output.
+func TestInvert(t *testing.T) {
+	out, _ := runGen(t, "16,14,13,11", wikipediaSeed, 128, false, false)
+	inverted, _ := runGen(t, "16,14,13,11", wikipediaSeed, 128, true, false)
+	if len(inverted) != len(out) {
+		t.Fatalf("inverted output has %d bytes, want %d", len(inverted), len(out))
+	}
+	for i := range out {
+		if inverted[i] != ^out[i] {
+			t.Errorf("byte %d: inverted %02x, want %02x", i, inverted[i], ^out[i])
+		}
+	}
+}
+
+// TestGenSummary checks the --summary fields for a maximal and a non-maximal
+// 4-stage register.
+func TestGenSummary(t *testing.T) {
+	tests := []struct {
+		poly string
+		want string
+	}{
+		{"4,3", "Summary:\n  Degree:         4\n  Taps:           2\n" +
+			"  Period:         15 (maximal 15)\n  Primitive:      yes\n  Bits generated: 32\n"},
+		// x^4 + x^2 + 1 is (x^2 + x + 1)^2
+		{"4,2", "Summary:\n  Degree:         4\n  Taps:           2\n" +
+			"  Period:         6 (maximal 15)\n  Primitive:      no\n  Bits generated: 32\n"},
+	}
+	for _, tt := range tests {
+		poly, degree, err := parsePoly(tt.poly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seed, err := parseSeed("1111", degree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summary bytes.Buffer
+		printGenSummary(&summary, poly, degree, seed, 32, registerForm{})
+		if summary.String() != tt.want {
+			t.Errorf("summary for %s =\n%s\nwant\n%s", tt.poly, summary.String(), tt.want)
+		}
+	}
+}
+
+// TestStateAt checks --state-at against the 3-stage register x^3 + x^2 + 1 clocked
+// by hand from 111. The feedback is stage 2 XOR stage 3 and enters stage 1:
+// 111 -> 011 -> 001 -> 100 -> 010 -> 101 -> 110 -> 111.
+func TestStateAt(t *testing.T) {
+	tests := []struct {
+		steps int64
+		want  string
+	}{
+		{0, "111"},
+		{1, "011"},
+		{3, "100"},
+		{6, "110"},
+		{7, "111"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := runStateAt(&out, "3,2", "111", tt.steps, registerForm{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != tt.want+"\n" {
+			t.Errorf("state after %d steps = %q, want %s", tt.steps, got, tt.want)
+		}
+	}
+}
+
+// TestStandardPRBS7 checks that --standard prbs7 gives the ITU-T O.150 PRBS7
+// sequence from its all-ones seed.
+func TestStandardPRBS7(t *testing.T) {
+	std, err := lookupStandard("prbs7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if std.mode != "gen" {
+		t.Errorf("prbs7 mode = %s, want gen", std.mode)
+	}
+	out, _ := runGen(t, std.poly, std.seed, 128, false, false)
+	if got := hex.EncodeToString(out); got != "fe041851e459d4fa1c49b5bd8d2ee655" {
+		t.Errorf("prbs7 output = %s, want fe041851e459d4fa1c49b5bd8d2ee655", got)
+	}
+	if _, err := lookupStandard("prbs8"); err == nil {
+		t.Error("unknown standard prbs8 accepted")
+	}
+}
+
+// TestDeBruijn checks that --debruijn on a maximal 3-stage register gives all 2^3
+// bits of the sequence, with each 3-bit window appearing exactly once, cyclically.
+func TestDeBruijn(t *testing.T) {
+	out, _ := runGen(t, "3,2", "111", 0, false, true)
+	bits := bitsString(bitio.BytesToBits(out))
+	if bits != "11100010" {
+		t.Fatalf("De Bruijn output = %s, want 11100010", bits)
+	}
+	seen := make(map[string]bool)
+	for i := range bits {
+		window := (bits + bits)[i : i+3]
+		if seen[window] {
+			t.Errorf("window %s appears twice", window)
+		}
+		seen[window] = true
+	}
+}
+
+// BenchmarkGenerate times 100 MB of PRBS31 from the packed generator and from the
+// serial clockRegister loop it replaced.
+func BenchmarkGenerate(b *testing.B) {
+	const numBits = 100 << 20 * 8
+	std, _ := lookupStandard("prbs31")
+	poly, degree, _ := parsePoly(std.poly)
+	seed, _ := parseSeed(std.seed, degree)
+	var form registerForm
+
+	b.Run("packed", func(b *testing.B) {
+		b.SetBytes(numBits / 8)
+		for i := 0; i < b.N; i++ {
+			bw := bitio.NewWriter(io.Discard)
+			if err := generatePacked(poly, degree, seed, numBits, false, bw, nil, form); err != nil {
+				b.Fatal(err)
+			}
+			bw.Close()
+		}
+	})
+	b.Run("serial", func(b *testing.B) {
+		b.SetBytes(numBits / 8)
+		for i := 0; i < b.N; i++ {
+			bw := bitio.NewWriter(io.Discard)
+			state := append([]byte(nil), seed...)
+			for n := 0; n < numBits; n++ {
+				if err := bw.Write([]byte{outputStage(state, form)}); err != nil {
+					b.Fatal(err)
+				}
+				clockRegister(state, poly, form)
+			}
+			bw.Close()
+		}
+	})
+}
+
+func bitsString(bits []byte) string {
+	text := make([]byte, len(bits))
+	for i, bit := range bits {
+		text[i] = '0' + bit
+	}
+	return string(text)
+}
@@ -0,0 +1,329 @@
+// Package crc computes CRCs of any width from 1 to 64 in the Rocksoft parameter
+// model used by the crc tool: a polynomial in normal form, an initial register
+// value, input and output reflection, and a final XOR.
+//
+// New returns a hash.Hash64, so a CRC can be fed through io.Copy or io.MultiWriter
+// like the hashes of hash/crc32 and hash/crc64. Checksum computes one in a single
+// call, and Combine joins the CRCs of two chunks without rereading either.
+package crc
+
+import (
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+)
+
+// Params holds the parameters of a CRC in the same convention as the crc tool's
+// flags and the Rocksoft model: Poly in normal form without the x^Width term, and
+// Init in normal order, reflected into the register when RefIn is set.
+type Params struct {
+	Width         int
+	Poly          uint64
+	Init          uint64
+	RefIn, RefOut bool
+	XorOut        uint64
+}
+
+// Digest is an incremental CRC. The register holds the state before the final
+// reflection and XOR, so Sum and Sum64 do not change it and more data can follow.
+type Digest struct {
+	params     Params
+	update     func(register uint64, data []byte) uint64
+	updateBits func(register uint64, b byte, count int) uint64
+	register   uint64
+}
+
+// New returns a hash.Hash64 computing the CRC described by params.
+// Params.Width must be from 1 to 64.
+func New(params Params) hash.Hash64 {
+	return NewDigest(params)
+}
+
+// NewDigest is New for callers that also need WriteBits or the raw register.
+func NewDigest(params Params) *Digest {
+	d := &Digest{
+		params:     params,
+		update:     updater(params.Width, params.Poly, params.RefIn),
+		updateBits: bitUpdater(params.Width, params.Poly, params.RefIn),
+	}
+	d.Reset()
+	return d
+}
+
+// Write never fails.
+func (d *Digest) Write(p []byte) (int, error) {
+	d.register = d.update(d.register, p)
+	return len(p), nil
+}
+
+// WriteBits feeds the first count bits of b, for a message that ends part way
+// through a byte. Bits are taken in the order Write consumes them: least
+// significant first with RefIn, most significant first without.
+func (d *Digest) WriteBits(b byte, count int) {
+	d.register = d.updateBits(d.register, b, count)
+}
+
+// Sum appends the CRC to b as Size bytes, most significant byte first.
+func (d *Digest) Sum(b []byte) []byte {
+	crc := d.Sum64()
+	for i := d.Size() - 1; i >= 0; i-- {
+		b = append(b, byte(crc>>uint(8*i)))
+	}
+	return b
+}
+
+func (d *Digest) Sum64() uint64 {
+	return finish(d.register, d.params.Width, d.params.RefIn, d.params.RefOut, d.params.XorOut)
+}
+
+// Reset reloads the register with Init. Only the low Width bits of Init are used.
+func (d *Digest) Reset() {
+	d.register = initRegister(d.params)
+}
+
+// Size is the number of bytes Sum appends, (Width+7)/8.
+func (d *Digest) Size() int {
+	return (d.params.Width + 7) / 8
+}
+
+func (d *Digest) BlockSize() int {
+	return 1
+}
+
+// Register returns the register before the final reflection and XOR, the state
+// to save for resuming the CRC later with SetRegister.
+func (d *Digest) Register() uint64 {
+	return d.register
+}
+
+// SetRegister replaces the register, for example with one saved by Register.
+func (d *Digest) SetRegister(register uint64) {
+	d.register = register & widthMask(d.params.Width)
+}
+
+// Checksum returns the CRC of data.
+func Checksum(data []byte, params Params) uint64 {
+	d := NewDigest(params)
+	d.Write(data)
+	return d.Sum64()
+}
+
+// --- Combining CRCs ---
+
+// Combine returns the CRC of A followed by B, given crc1 of A and crc2 of B (each
+// computed from Init with params) and len2, the length of B in bytes. It takes
+// O(width^2 log len2) time, like zlib's crc32_combine.
+//
+// The register update is linear apart from Init: the register after B is
+// Z^len2(register after A) XOR Z^len2(Init) XOR (register for B from Init), where Z
+// advances the register over one zero byte. Z^len2 is found by repeated squaring.
+func Combine(crc1, crc2 uint64, len2 int, params Params) uint64 {
+	width := params.Width
+	mask := widthMask(width)
+	// Undo the final XOR and reflection to get back to the register
+	toRegister := func(crc uint64) uint64 {
+		crc = (crc ^ params.XorOut) & mask
+		if params.RefIn != params.RefOut {
+			crc = Reflect(crc, width)
+		}
+		return crc
+	}
+	register1 := toRegister(crc1)
+	register2 := toRegister(crc2)
+	init := initRegister(params)
+
+	// zeros[i] is Z applied to register bit i
+	update := updater(width, params.Poly, params.RefIn)
+	zero := []byte{0}
+	zeros := make([]uint64, width)
+	for i := range zeros {
+		zeros[i] = update(1<<uint(i), zero)
+	}
+
+	// Apply Z^len2 to register1 XOR Init, squaring Z for each bit of len2
+	v := register1 ^ init
+	for n := len2; n > 0 && v != 0; n >>= 1 {
+		if n&1 == 1 {
+			v = gf2MatrixTimes(zeros, v)
+		}
+		if n > 1 {
+			zeros = gf2MatrixSquare(zeros)
+		}
+	}
+	return finish(v^register2, width, params.RefIn, params.RefOut, params.XorOut)
+}
+
+// gf2MatrixTimes multiplies the vector v by the matrix whose column i is mat[i].
+func gf2MatrixTimes(mat []uint64, v uint64) uint64 {
+	var sum uint64
+	for i := 0; v != 0; i, v = i+1, v>>1 {
+		if v&1 == 1 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+// gf2MatrixSquare returns mat times itself.
+func gf2MatrixSquare(mat []uint64) []uint64 {
+	square := make([]uint64, len(mat))
+	for i, column := range mat {
+		square[i] = gf2MatrixTimes(mat, column)
+	}
+	return square
+}
+
+// --- Table-Driven CRC Implementation ---
+
+// updater returns a function that advances the CRC register over data. With
+// refin the register is kept reflected, least significant bit first. Otherwise it
+// is kept in normal order.
+func updater(width int, poly uint64, refin bool) func(register uint64, data []byte) uint64 {
+	if refin {
+		return reflectedUpdater(width, poly)
+	}
+	return normalUpdater(width, poly)
+}
+
+// initRegister returns Init as the register updater starts from, reflected for a
+// RefIn CRC.
+func initRegister(params Params) uint64 {
+	init := params.Init & widthMask(params.Width)
+	if params.RefIn {
+		init = Reflect(init, params.Width)
+	}
+	return init
+}
+
+// finish turns a register from updater into the CRC value. A reflected
+// register already holds the reflected output.
+func finish(register uint64, width int, refin, refout bool, xorout uint64) uint64 {
+	if refin != refout {
+		register = Reflect(register, width)
+	}
+	return (register ^ xorout) & widthMask(width)
+}
+
+// widthMask returns a mask of the low width bits.
+func widthMask(width int) uint64 {
+	return ^uint64(0) >> uint(64-width)
+}
+
+// reflectedUpdater returns a function that advances a reflected CRC register of any
+// width from 1 to 64 over data. The register is held in the low width bits, least
+// significant bit first, and is not XORed with xorout. CRC-32 and CRC-32C use
+// hash/crc32, which is hardware accelerated on most platforms, and the ECMA-182 and
+// ISO 64-bit polynomials use the slicing-by-8 tables of hash/crc64.
+func reflectedUpdater(width int, poly uint64) func(register uint64, data []byte) uint64 {
+	if width == 32 && (poly == 0x04C11DB7 || poly == 0x1EDC6F41) {
+		table := crc32.IEEETable
+		if poly == 0x1EDC6F41 {
+			table = crc32.MakeTable(crc32.Castagnoli)
+		}
+		// crc32.Update complements the register on the way in and out
+		return func(register uint64, data []byte) uint64 {
+			return uint64(^crc32.Update(^uint32(register), table, data))
+		}
+	}
+	if width == 64 && (poly == 0x42F0E1EBA9EA3693 || poly == 0x1B) {
+		table := crc64.MakeTable(crc64.ECMA)
+		if poly == 0x1B {
+			table = crc64.MakeTable(crc64.ISO)
+		}
+		// Like crc32.Update, crc64.Update complements the register on the way in and out
+		return func(register uint64, data []byte) uint64 {
+			return ^crc64.Update(^register, table, data)
+		}
+	}
+	table := makeReflectedTable(width, poly)
+	return func(register uint64, data []byte) uint64 {
+		for _, b := range data {
+			register = table[byte(register)^b] ^ register>>8
+		}
+		return register
+	}
+}
+
+// bitUpdater returns a bit-serial update for the first count bits of b, for the
+// partial byte at the end of a message. Bits are taken in the order the table loop
+// consumes them: least significant first with refin, most significant first without.
+func bitUpdater(width int, poly uint64, refin bool) func(register uint64, b byte, count int) uint64 {
+	mask := widthMask(width)
+	if refin {
+		reflected := Reflect(poly, width)
+		return func(register uint64, b byte, count int) uint64 {
+			for i := 0; i < count; i++ {
+				feedback := (register ^ uint64(b>>uint(i))) & 1
+				register >>= 1
+				if feedback == 1 {
+					register ^= reflected
+				}
+			}
+			return register
+		}
+	}
+	return func(register uint64, b byte, count int) uint64 {
+		for i := 0; i < count; i++ {
+			feedback := (register>>uint(width-1) ^ uint64(b>>uint(7-i))) & 1
+			register = register << 1 & mask
+			if feedback == 1 {
+				register ^= poly
+			}
+		}
+		return register
+	}
+}
+
+// normalUpdater returns a function that advances a register held in normal order,
+// in the low width bits, over data, most significant bit of each byte first. The
+// table keeps the register in the top bits of a uint64 so one loop serves every width.
+func normalUpdater(width int, poly uint64) func(register uint64, data []byte) uint64 {
+	var table [256]uint64
+	top := poly << uint(64-width)
+	for b := range table {
+		r := uint64(b) << 56
+		for i := 0; i < 8; i++ {
+			if r&(1<<63) != 0 {
+				r = r<<1 ^ top
+			} else {
+				r <<= 1
+			}
+		}
+		table[b] = r
+	}
+	return func(register uint64, data []byte) uint64 {
+		reg := register << uint(64-width)
+		for _, b := range data {
+			reg = reg<<8 ^ table[byte(reg>>56)^b]
+		}
+		return reg >> uint(64-width)
+	}
+}
+
+// makeReflectedTable builds the byte-at-a-time table for the reflected form of
+// poly. It also serves widths below 8, whose register fits in the table index.
+func makeReflectedTable(width int, poly uint64) *[256]uint64 {
+	reflected := Reflect(poly, width)
+	var table [256]uint64
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ reflected
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return &table
+}
+
+// Reflect reverses the low width bits of v.
+func Reflect(v uint64, width int) uint64 {
+	var r uint64
+	for i := 0; i < width; i++ {
+		r = r<<1 | v>>uint(i)&1
+	}
+	return r
+}
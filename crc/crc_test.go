@@ -0,0 +1,127 @@
+package crc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+var check = []byte("123456789")
+
+// checkParams are catalog entries covering reflected and normal registers, the
+// hash/crc32 and hash/crc64 fast paths, widths below 8, and a reflected CRC with
+// an asymmetric Init, which the Rocksoft model reflects into the register.
+var checkParams = []struct {
+	name   string
+	params Params
+	want   uint64
+}{
+	{"CRC-32", Params{32, 0x04C11DB7, 0xFFFFFFFF, true, true, 0xFFFFFFFF}, 0xcbf43926},
+	{"CRC-32C", Params{32, 0x1EDC6F41, 0xFFFFFFFF, true, true, 0xFFFFFFFF}, 0xe3069283},
+	{"CRC-32/BZIP2", Params{32, 0x04C11DB7, 0xFFFFFFFF, false, false, 0xFFFFFFFF}, 0xfc891918},
+	{"CRC-16/CCITT-FALSE", Params{16, 0x1021, 0xFFFF, false, false, 0}, 0x29b1},
+	{"CRC-16/MODBUS", Params{16, 0x8005, 0xFFFF, true, true, 0}, 0x4b37},
+	{"CRC-64/XZ", Params{64, 0x42F0E1EBA9EA3693, 0xFFFFFFFFFFFFFFFF, true, true, 0xFFFFFFFFFFFFFFFF}, 0x995dc9bbdf1939fa},
+	{"CRC-8", Params{8, 0x07, 0, false, false, 0}, 0xf4},
+	{"CRC-5/USB", Params{5, 0x05, 0x1F, true, true, 0x1F}, 0x19},
+	{"CRC-16/RIELLO", Params{16, 0x1021, 0xB2AA, true, true, 0}, 0x63d0},
+}
+
+func TestChecksum(t *testing.T) {
+	for _, tt := range checkParams {
+		if got := Checksum(check, tt.params); got != tt.want {
+			t.Errorf("%s: Checksum = 0x%x, want 0x%x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	for _, tt := range checkParams {
+		h := New(tt.params)
+		io.Copy(h, bytes.NewReader(check[:4]))
+		h.Write(check[4:])
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("%s: Sum64 after two writes = 0x%x, want 0x%x", tt.name, got, tt.want)
+		}
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("%s: second Sum64 = 0x%x, want 0x%x", tt.name, got, tt.want)
+		}
+		h.Reset()
+		h.Write(check)
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("%s: Sum64 after Reset = 0x%x, want 0x%x", tt.name, got, tt.want)
+		}
+	}
+
+	sum := New(checkParams[3].params)
+	sum.Write(check)
+	if got := hex.EncodeToString(sum.Sum([]byte{0xAA})); got != "aa29b1" {
+		t.Errorf("Sum appended %s, want aa29b1", got)
+	}
+}
+
+func TestWriteBits(t *testing.T) {
+	// A single 1 bit with poly 0x07 shifts once and XORs in the poly
+	d := NewDigest(Params{Width: 8, Poly: 0x07})
+	d.WriteBits(0x80, 1)
+	if got := d.Sum64(); got != 0x07 {
+		t.Errorf("CRC-8 of one 1 bit = 0x%x, want 0x07", got)
+	}
+
+	// Eight bits one at a time match a whole byte in both bit orders
+	for _, tt := range checkParams {
+		whole := Checksum(check[:1], tt.params)
+		d := NewDigest(tt.params)
+		for i := 0; i < 8; i++ {
+			b := check[0] >> uint(i)
+			if !tt.params.RefIn {
+				b = check[0] << uint(i)
+			}
+			d.WriteBits(b, 1)
+		}
+		if got := d.Sum64(); got != whole {
+			t.Errorf("%s: bit-serial byte = 0x%x, want 0x%x", tt.name, got, whole)
+		}
+	}
+}
+
+// TestWriteBitsLongDivision checks 12- and 13-bit messages, a whole byte plus a
+// partial one, against the remainder of M(x)*x^8 divided by x^8+x^2+x+1 worked by
+// hand. The message is 0xB1 0x0F, whose bits are 1011 0001 0000 1111 most
+// significant first and 1000 1101 1111 0000 least significant first.
+func TestWriteBitsLongDivision(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		bits   int
+		want   uint64
+	}{
+		// 1011 0001 0000 0000 0000 mod 1 0000 0111 = 1110 0111
+		{"12 bits MSB first", Params{Width: 8, Poly: 0x07}, 12, 0xe7},
+		// 1011 0001 0000 1000 0000 0 mod 1 0000 0111 = 1100 1110
+		{"13 bits MSB first", Params{Width: 8, Poly: 0x07}, 13, 0xce},
+		// 1000 1101 1111 0000 0000 0 mod 1 0000 0111 = 0111 0001, reflected to 1000 1110
+		{"13 bits LSB first", Params{Width: 8, Poly: 0x07, RefIn: true, RefOut: true}, 13, 0x8e},
+	}
+	for _, tt := range tests {
+		d := NewDigest(tt.params)
+		d.Write([]byte{0xB1})
+		d.WriteBits(0x0F, tt.bits-8)
+		if got := d.Sum64(); got != tt.want {
+			t.Errorf("%s: CRC = 0x%02x, want 0x%02x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	for _, tt := range checkParams {
+		for _, split := range []int{0, 1, 4, 9} {
+			crc1 := Checksum(check[:split], tt.params)
+			crc2 := Checksum(check[split:], tt.params)
+			if got := Combine(crc1, crc2, len(check)-split, tt.params); got != tt.want {
+				t.Errorf("%s: Combine at %d = 0x%x, want 0x%x", tt.name, split, got, tt.want)
+			}
+		}
+	}
+}
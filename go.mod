@@ -0,0 +1,3 @@
+module github.com/PaulW-NZ/Bit-tools
+
+go 1.21
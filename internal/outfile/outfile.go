@@ -0,0 +1,58 @@
+// Package outfile creates the output files of the tools in this repository. It
+// honours their shared --no-clobber and --output-bits-exact options, so every
+// tool refuses to overwrite files and records exact bit lengths the same way.
+package outfile
+
+import (
+	"fmt"
+	"os"
+)
+
+// NoClobber makes Create and WriteFile refuse to replace existing files. The
+// tools set it from --no-clobber, cleared by --force.
+var NoClobber bool
+
+// Create creates path for writing. When NoClobber is set it refuses to replace a
+// file that already exists.
+func Create(path string) (*os.File, error) {
+	return open(path, 0666)
+}
+
+// WriteFile writes data to path, refusing to replace it when NoClobber is set.
+func WriteFile(path string, data []byte) error {
+	file, err := open(path, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func open(path string, perm os.FileMode) (*os.File, error) {
+	if !NoClobber {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("refusing to overwrite existing file %s (--no-clobber)", path)
+	}
+	return file, err
+}
+
+// ReportExactBits records the exact output length, since the final byte is
+// zero-padded. For a file it writes "<path>.bits"; for stdout it prints to stderr.
+func ReportExactBits(path string, totalBits int64) error {
+	lastByteBits := totalBits % 8
+	if lastByteBits == 0 && totalBits > 0 {
+		lastByteBits = 8
+	}
+	line := fmt.Sprintf("bits=%d last-byte-bits=%d\n", totalBits, lastByteBits)
+	if path == "" || path == "-" {
+		fmt.Fprint(os.Stderr, "Output "+line)
+		return nil
+	}
+	return WriteFile(path+".bits", []byte(line))
+}
@@ -0,0 +1,58 @@
+package outfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportExactBits(t *testing.T) {
+	tests := []struct {
+		bits int64
+		want string
+	}{
+		{13, "bits=13 last-byte-bits=5\n"},
+		{16, "bits=16 last-byte-bits=8\n"},
+		{0, "bits=0 last-byte-bits=0\n"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "out.bin")
+		if err := ReportExactBits(path, tt.bits); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path + ".bits")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%d bits: sidecar = %q, want %q", tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestNoClobber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	NoClobber = true
+	defer func() { NoClobber = false }()
+	if _, err := Create(path); err == nil {
+		t.Error("Create replaced an existing file with NoClobber set")
+	}
+	if err := WriteFile(path, []byte("new")); err == nil {
+		t.Error("WriteFile replaced an existing file with NoClobber set")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "old" {
+		t.Errorf("file = %q after refused writes, want old", got)
+	}
+
+	NoClobber = false
+	if err := WriteFile(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Errorf("file = %q, want new", got)
+	}
+}